@@ -18,37 +18,28 @@ package analyser
 // https://redhatinsights.github.io/ccx-data-pipeline-monitor/packages/analyser/aggregator.html
 
 import (
-	"bufio"
 	"encoding/json"
 	"fmt"
-	"log"
-	"os"
 	"strconv"
+	"time"
 
 	"github.com/logrusorgru/aurora"
 
 	"github.com/RedHatInsights/ccx-data-pipeline-monitor/config"
 )
 
-// Filters
-const (
-	readFilter              = "Read"
-	marshalledFilter        = "Marshalled"
-	timeOkFilter            = "Time ok"
-	storedFilter            = "Stored"
-	consumedFilter          = "Consumed"
-	organizationWhitelisted = "Organization whitelisted"
-)
-
 // Messages
 const (
 	emptyLog         = "Empty log"
 	logsAreNotLoaded = "Logs are not loaded"
+
+	unknownTransition = "Unknown funnel transition"
 )
 
 // Log leves for analyzed files
 const (
-	entryLevelError = "error"
+	entryLevelError   = "error"
+	entryLevelWarning = "warn"
 )
 
 // Others
@@ -56,6 +47,12 @@ const (
 	timeAndMessageTemplate = "\t%s  %s\n"
 )
 
+// unknownPartition is used for log entries that don't contain partition
+const unknownPartition = -1
+
+// aggregatorTimeFormat is the format of timestamps produced by aggregator
+const aggregatorTimeFormat = time.RFC3339Nano
+
 // AggregatorLogEntry represents one log entry (record) read from log file.
 type AggregatorLogEntry struct {
 	Level        string `json:"level"`
@@ -64,298 +61,267 @@ type AggregatorLogEntry struct {
 	Type         string `json:"type"`
 	Error        string `json:"error"`
 	Topic        string `json:"topic"`
+	Partition    int    `json:"partition"`
 	Offset       int    `json:"offset"`
 	Group        string `json:"group"`
 	Organization int    `json:"organization"`
 	Cluster      string `json:"cluster"`
-}
-
-var aggregatorEntries []AggregatorLogEntry = nil
+	Pod          string `json:"pod"`
+	SourceFile   string `json:"source_file"`
 
-func readAggregatorLogFile(filename string) ([]AggregatorLogEntry, error) {
-	entries := []AggregatorLogEntry{}
+	// Timestamp contains parsed Time, it is zero when Time can't be parsed
+	Timestamp time.Time `json:"-"`
+}
 
-	// disable "G304 (CWE-22): Potential file inclusion via variable"
-	file, err := os.Open(filename) // #nosec G304
+// parseAggregatorLogEntry function parses one log entry. Entries without
+// partition field are marked by unknownPartition value.
+func parseAggregatorLogEntry(text string) (AggregatorLogEntry, error) {
+	entry := AggregatorLogEntry{
+		Partition: unknownPartition,
+	}
+	err := json.Unmarshal([]byte(text), &entry)
 	if err != nil {
-		return nil, err
+		return entry, err
 	}
 
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		entry := AggregatorLogEntry{}
-		text := scanner.Text()
-		err = json.Unmarshal([]byte(text), &entry)
-		if err != nil {
-			log.Println(err)
-			log.Println(text)
-		} else {
-			entries = append(entries, entry)
-		}
-	}
+	// entries with unknown time are still useful
+	entry.Timestamp, _ = parseAggregatorTime(entry.Time)
+	return entry, nil
+}
 
-	if err := scanner.Err(); err != nil {
-		return entries, err
+func formatPartition(partition int) string {
+	if partition == unknownPartition {
+		return "-"
 	}
+	return strconv.Itoa(partition)
+}
+
+// parseAggregatorTime function parses timestamp used in aggregator logs
+func parseAggregatorTime(timestamp string) (time.Time, error) {
+	return time.Parse(aggregatorTimeFormat, timestamp)
+}
 
-	// log file needs to be closed properly
-	// try to close the file
-	err = file.Close()
+// readAggregatorLogFile function reads the log file entry by entry and
+// builds index for all entries. Entries themselves are not kept in memory.
+func readAggregatorLogFile(filename string) (*aggregatorIndex, error) {
+	index := newAggregatorIndex(filename)
 
-	// in case of error all we can do is to just log the error
+	err := scanLogFile(filename, index.scan)
 	if err != nil {
-		log.Println(err)
+		return nil, err
 	}
 
-	return entries, nil
+	return index, nil
 }
 
-func filterConsumedMessages(entries []AggregatorLogEntry) []AggregatorLogEntry {
-	consumed := []AggregatorLogEntry{}
+// minimal width of the first column of aggregator statistic
+const statisticWidth = 12
 
-	for i := range entries {
-		if entries[i].Message == consumedFilter && entries[i].Group != "" {
-			consumed = append(consumed, entries[i])
-		}
-	}
-	return consumed
+func printStatisticLine(colorizer aurora.Aurora, width int, what string, count, previousCount int) {
+	e := strconv.Itoa(count)
+	x := strconv.Itoa(previousCount - count)
+	fmt.Printf("%-*s %s messages (%s excluded)\n", width, what, colorizer.Blue(e), colorizer.Red(x))
 }
 
-func filterByMessage(entries []AggregatorLogEntry, message string) []AggregatorLogEntry {
-	filtered := []AggregatorLogEntry{}
-
-	for i := range entries {
-		if entries[i].Message == message && entries[i].Topic != "" &&
-			entries[i].Organization != 0 && entries[i].Cluster != "" &&
-			entries[i].Group == "" {
-			filtered = append(filtered, entries[i])
-		}
+// statisticWidth method returns width of the first column of statistic
+func (index *aggregatorIndex) statisticWidth() int {
+	if width := index.funnel.nameWidth(); width > statisticWidth {
+		return width
 	}
-	return filtered
+	return statisticWidth
 }
 
-func printStatisticLine(colorizer aurora.Aurora, what string, entries, nextEntries []AggregatorLogEntry) {
-	e := strconv.Itoa(len(entries))
-	x := strconv.Itoa(len(nextEntries) - len(entries))
-	fmt.Printf("%-12s %s messages (%s excluded)\n", what, colorizer.Blue(e), colorizer.Red(x))
+// printAggregatorStatistic function prints number of messages that reached
+// each funnel stage. Messages excluded are those that reached the
+// predecessor of the stage, but not the stage itself.
+func printAggregatorStatistic(colorizer aurora.Aurora, index *aggregatorIndex, window TimeWindow) {
+	printFunnelStatistic(colorizer, &index.funnelIndex, index.statisticWidth(), window)
+	printAggregatorRestarts(colorizer, index, window)
 }
 
-func printAggregatorStatistic(colorizer aurora.Aurora, entries []AggregatorLogEntry) {
-	consumed := filterConsumedMessages(entries)
-	read := filterByMessage(entries, readFilter)
-	whitelisted := filterByMessage(entries, organizationWhitelisted)
-	marshalled := filterByMessage(entries, marshalledFilter)
-	checked := filterByMessage(entries, timeOkFilter)
-	stored := filterByMessage(entries, storedFilter)
-
-	printStatisticLine(colorizer, consumedFilter, consumed, consumed)
-	printStatisticLine(colorizer, readFilter, read, consumed)
-	printStatisticLine(colorizer, "Whitelisted", whitelisted, read)
-	printStatisticLine(colorizer, marshalledFilter, marshalled, whitelisted)
-	printStatisticLine(colorizer, "Checked", checked, marshalled)
-	printStatisticLine(colorizer, storedFilter, stored, checked)
+// printAggregatorRestarts function prints all container restarts within
+// given time window together with number of messages consumed before the
+// restart that have never been stored
+func printAggregatorRestarts(colorizer aurora.Aurora, index *aggregatorIndex, window TimeWindow) {
+	lost := index.lostInRestarts()
+	for i := range index.restarts {
+		restart := &index.restarts[i]
+		if !window.containsNano(restart.time) {
+			continue
+		}
+		when := time.Unix(0, restart.time).UTC().Format(aggregatorTimeFormat)
+		fmt.Printf("%-*s %s  %s  %s messages not stored\n", index.statisticWidth(), "Restart", colorizer.Gray(8, when), restart.pod, colorizer.Red(strconv.Itoa(lost[restart])))
+	}
 }
 
 func printConsumedEntry(colorizer aurora.Aurora, i int, entry *AggregatorLogEntry) {
 	e := strconv.Itoa(i)
-	fmt.Printf("%5s  %s  %s  %s  %d\t", colorizer.Blue(e), colorizer.Gray(8, entry.Time), entry.Group, entry.Topic, colorizer.Cyan(entry.Offset))
+	fmt.Printf("%5s  %s  %s  %s  %s  %d", colorizer.Blue(e), colorizer.Gray(8, entry.Time), entry.Group, entry.Topic, formatPartition(entry.Partition), colorizer.Cyan(entry.Offset))
+	printEntrySource(colorizer, entry.Pod, entry.SourceFile)
 }
 
 func printReadEntry(colorizer aurora.Aurora, i int, entry *AggregatorLogEntry) {
 	e := strconv.Itoa(i)
-	fmt.Printf("%5s  %s  %s  %s  %d  %d  %s\t", colorizer.Blue(e), colorizer.Gray(8, entry.Time), entry.Group, entry.Topic, colorizer.Cyan(entry.Offset), colorizer.Yellow(entry.Organization), entry.Cluster)
+	fmt.Printf("%5s  %s  %s  %s  %s  %d  %d  %s", colorizer.Blue(e), colorizer.Gray(8, entry.Time), entry.Group, entry.Topic, formatPartition(entry.Partition), colorizer.Cyan(entry.Offset), colorizer.Yellow(entry.Organization), entry.Cluster)
+	printEntrySource(colorizer, entry.Pod, entry.SourceFile)
 }
 
-func printErrorsForMessageWithOffset(colorizer aurora.Aurora, entries []AggregatorLogEntry, offset int) {
-	for i := range entries {
-		if entries[i].Offset == offset && entries[i].Level == entryLevelError {
-			fmt.Printf(timeAndMessageTemplate, colorizer.Gray(8, entries[i].Time), colorizer.Red(entries[i].Error))
+func printErrorsForMessageWithKey(colorizer aurora.Aurora, reader aggregatorReader, index *aggregatorIndex, key messageKey) error {
+	for _, item := range index.errorsFor(key) {
+		entry, err := reader.entry(item.location)
+		if err != nil {
+			return err
+		}
+		fmt.Printf(timeAndMessageTemplate, colorizer.Gray(8, entry.Time), colorizer.Red(entry.Error))
+		err = printAttachedText(colorizer, reader.logReader, &index.lines, item.location)
+		if err != nil {
+			return err
 		}
 	}
+	return nil
 }
 
-func printMessageForErrorsMessageWithOffset(colorizer aurora.Aurora, entries []AggregatorLogEntry, offset int) {
-	for i := range entries {
-		if entries[i].Offset == offset && entries[i].Level == "error" {
-			fmt.Printf(timeAndMessageTemplate, colorizer.Gray(8, entries[i].Time), colorizer.Red(entries[i].Message))
+func printMessageForErrorsMessageWithKey(colorizer aurora.Aurora, reader aggregatorReader, index *aggregatorIndex, key messageKey) error {
+	for _, item := range index.errorsFor(key) {
+		entry, err := reader.entry(item.location)
+		if err != nil {
+			return err
+		}
+		fmt.Printf(timeAndMessageTemplate, colorizer.Gray(8, entry.Time), colorizer.Red(entry.Message))
+		err = printAttachedText(colorizer, reader.logReader, &index.lines, item.location)
+		if err != nil {
+			return err
 		}
 	}
+	return nil
 }
 
-func printConsumedEntries(colorizer aurora.Aurora, entries, notRead []AggregatorLogEntry) {
-	for i := range notRead {
-		printConsumedEntry(colorizer, i+1, &notRead[i])
-		printErrorsForMessageWithOffset(colorizer, entries, notRead[i].Offset)
+// printRestartAfter function prints container restart that interrupted
+// processing of the message
+func printRestartAfter(colorizer aurora.Aurora, index *aggregatorIndex, item stageItem) {
+	restart := index.restartAfter(item)
+	if restart != nil {
+		when := time.Unix(0, restart.time).UTC().Format(aggregatorTimeFormat)
+		fmt.Printf(timeAndMessageTemplate, colorizer.Gray(8, when), colorizer.Red("lost in restart of "+restart.pod))
 	}
-	fmt.Println()
 }
 
-func printReadEntries(colorizer aurora.Aurora, entries, notRead []AggregatorLogEntry) {
-	for i := range notRead {
-		printReadEntry(colorizer, i+1, &notRead[i])
-		printMessageForErrorsMessageWithOffset(colorizer, entries, notRead[i].Offset)
+func printConsumedEntries(colorizer aurora.Aurora, index *aggregatorIndex, notRead []stageItem) error {
+	reader, err := index.open()
+	if err != nil {
+		return err
 	}
-	fmt.Println()
-}
+	defer reader.close()
 
-func messageWithOffsetIn(entries []AggregatorLogEntry, offset int) bool {
-	for i := range entries {
-		if entries[i].Offset == offset {
-			return true
+	for i, item := range notRead {
+		entry, err := reader.entry(item.location)
+		if err != nil {
+			return err
 		}
-	}
-	return false
-}
-
-func diffEntryListsByOffset(list1, list2 []AggregatorLogEntry) []AggregatorLogEntry {
-	diff := []AggregatorLogEntry{}
-	for i := range list1 {
-		if !messageWithOffsetIn(list2, list1[i].Offset) {
-			diff = append(diff, list1[i])
+		printConsumedEntry(colorizer, i+1, entry)
+		printRestartAfter(colorizer, index, item)
+		err = printErrorsForMessageWithKey(colorizer, reader, index, item.key)
+		if err != nil {
+			return err
 		}
 	}
-	return diff
-}
-
-func getConsumedNotReadMessages(entries []AggregatorLogEntry) []AggregatorLogEntry {
-	consumed := filterConsumedMessages(entries)
-	read := filterByMessage(entries, readFilter)
-	return diffEntryListsByOffset(consumed, read)
-}
-
-func getNotWhitelistedMessages(entries []AggregatorLogEntry) []AggregatorLogEntry {
-	read := filterByMessage(entries, readFilter)
-	whitelisted := filterByMessage(entries, organizationWhitelisted)
-	return diffEntryListsByOffset(read, whitelisted)
-}
-
-func getNotMarshalledMessages(entries []AggregatorLogEntry) []AggregatorLogEntry {
-	whitelisted := filterByMessage(entries, organizationWhitelisted)
-	marshalled := filterByMessage(entries, marshalledFilter)
-	return diffEntryListsByOffset(whitelisted, marshalled)
-}
-
-func getNotCheckedMessages(entries []AggregatorLogEntry) []AggregatorLogEntry {
-	marshalled := filterByMessage(entries, marshalledFilter)
-	checked := filterByMessage(entries, timeOkFilter)
-	return diffEntryListsByOffset(marshalled, checked)
-}
-
-func getNotStoredMessages(entries []AggregatorLogEntry) []AggregatorLogEntry {
-	checked := filterByMessage(entries, timeOkFilter)
-	stored := filterByMessage(entries, storedFilter)
-	return diffEntryListsByOffset(checked, stored)
-}
-
-func printConsumedNotRead(colorizer aurora.Aurora, entries []AggregatorLogEntry) {
-	notRead := getConsumedNotReadMessages(entries)
-	printConsumedEntries(colorizer, entries, notRead)
-}
-
-func printNotWhitelisted(colorizer aurora.Aurora, entries []AggregatorLogEntry) {
-	notWhitelisted := getNotWhitelistedMessages(entries)
-	printReadEntries(colorizer, entries, notWhitelisted)
-}
-
-func printWhitelistedNotMarshalled(colorizer aurora.Aurora, entries []AggregatorLogEntry) {
-	notMarshalled := getNotMarshalledMessages(entries)
-	printReadEntries(colorizer, entries, notMarshalled)
-}
-
-func printMarshalledNotChecked(colorizer aurora.Aurora, entries []AggregatorLogEntry) {
-	notChecked := getNotCheckedMessages(entries)
-	printReadEntries(colorizer, entries, notChecked)
-}
-
-func printCheckedNotStored(colorizer aurora.Aurora, entries []AggregatorLogEntry) {
-	notStored := getNotStoredMessages(entries)
-	printReadEntries(colorizer, entries, notStored)
+	fmt.Println()
+	return nil
 }
 
-// ReadAggregatorLogFiles reads all log files gathered from aggregator pods.
-func ReadAggregatorLogFiles() (int, error) {
-	var err error
-	aggregatorEntries, err = readAggregatorLogFile(config.AggregatorLogFileName)
+func printReadEntries(colorizer aurora.Aurora, index *aggregatorIndex, notRead []stageItem) error {
+	reader, err := index.open()
 	if err != nil {
-		return 0, err
+		return err
 	}
-	return len(aggregatorEntries), nil
-}
+	defer reader.close()
 
-// PrintAggregatorStatistic prints statistic gathered from aggregator logs.
-func PrintAggregatorStatistic(colorizer aurora.Aurora) {
-	if aggregatorEntries == nil {
-		fmt.Println(colorizer.Red(logsAreNotLoaded))
-		return
-	}
-	if len(aggregatorEntries) == 0 {
-		fmt.Println(colorizer.Red(emptyLog))
-		return
+	for i, item := range notRead {
+		entry, err := reader.entry(item.location)
+		if err != nil {
+			return err
+		}
+		printReadEntry(colorizer, i+1, entry)
+		printRestartAfter(colorizer, index, item)
+		err = printMessageForErrorsMessageWithKey(colorizer, reader, index, item.key)
+		if err != nil {
+			return err
+		}
 	}
-	printAggregatorStatistic(colorizer, aggregatorEntries)
+	fmt.Println()
+	return nil
 }
 
-// PrintAggregatorConsumedNotReadMessages function prints all messages that are consumer (from input) but not read for any reason
-func PrintAggregatorConsumedNotReadMessages(colorizer aurora.Aurora) {
-	if aggregatorEntries == nil {
-		fmt.Println(colorizer.Red(logsAreNotLoaded))
-		return
-	}
-	if len(aggregatorEntries) == 0 {
-		fmt.Println(colorizer.Red(emptyLog))
-		return
+// printStuckItems function prints messages stuck after given stage. Messages
+// stuck after the first stage are printed by their consume records, other
+// messages together with owner of the report.
+func printStuckItems(colorizer aurora.Aurora, index *aggregatorIndex, stage int, stuck []stageItem) error {
+	if stage == index.funnel.first {
+		return printConsumedEntries(colorizer, index, stuck)
 	}
-	printConsumedNotRead(colorizer, aggregatorEntries)
+	return printReadEntries(colorizer, index, stuck)
 }
 
-// PrintAggregatorConsumedNotWhitelisted function prints all consumed, but not whitelisted messages, ie. messages that have been filtered
-func PrintAggregatorConsumedNotWhitelisted(colorizer aurora.Aurora) {
-	if aggregatorEntries == nil {
-		fmt.Println(colorizer.Red(logsAreNotLoaded))
-		return
+// printStuckMessages function prints all messages that reached the first
+// stage of the transition within given time window, but did not reach the
+// second one
+func printStuckMessages(colorizer aurora.Aurora, index *aggregatorIndex, transition [2]int, window TimeWindow) error {
+	stuck := index.stuckAfter(transition[0], transition[1], window)
+	return printStuckItems(colorizer, index, transition[0], stuck)
+}
+
+// ReadAggregatorLogFiles reads all log files gathered from aggregator pods.
+// When log files are given, they are merged into aggregator.log first and
+// number of skipped duplicate lines is returned too.
+func ReadAggregatorLogFiles(filenames ...string) (entries, duplicates int, err error) {
+	if len(filenames) > 0 {
+		duplicates, err = loadLogFiles(filenames, config.AggregatorLogFileName, aggregatorLogFormat)
+		if err != nil {
+			return 0, 0, err
+		}
 	}
-	if len(aggregatorEntries) == 0 {
-		fmt.Println(colorizer.Red(emptyLog))
-		return
+	aggregatorStageIndex, err = readAggregatorLogFile(config.AggregatorLogFileName)
+	if err != nil {
+		return 0, duplicates, err
 	}
-	printNotWhitelisted(colorizer, aggregatorEntries)
+	return aggregatorStageIndex.entries, duplicates, nil
 }
 
-// PrintAggregatorWhitelistedNotMarshalled function prints whitelisted messages (that are supposed to be processed) that can't be marshalled for any reason
-func PrintAggregatorWhitelistedNotMarshalled(colorizer aurora.Aurora) {
-	if aggregatorEntries == nil {
+// PrintAggregatorStatistic prints statistic gathered from aggregator logs
+// within given time window.
+func PrintAggregatorStatistic(colorizer aurora.Aurora, window TimeWindow) {
+	if aggregatorStageIndex == nil {
 		fmt.Println(colorizer.Red(logsAreNotLoaded))
 		return
 	}
-	if len(aggregatorEntries) == 0 {
+	if aggregatorStageIndex.entries == 0 {
 		fmt.Println(colorizer.Red(emptyLog))
 		return
 	}
-	printWhitelistedNotMarshalled(colorizer, aggregatorEntries)
+	printAggregatorStatistic(colorizer, aggregatorStageIndex, window)
 }
 
-// PrintAggregatorMarshalledNotChecked function prints messages that can be marshalled but are not checked for any reason (improper internal structure etc.)
-func PrintAggregatorMarshalledNotChecked(colorizer aurora.Aurora) {
-	if aggregatorEntries == nil {
+// PrintAggregatorStuckMessages function prints all messages that passed
+// through given transition of aggregator funnel only halfway, for example
+// messages that have been consumed, but not read for any reason.
+// Transitions are numbered from zero in the order returned by
+// AggregatorFunnelTransitions.
+func PrintAggregatorStuckMessages(colorizer aurora.Aurora, window TimeWindow, transition int) {
+	if aggregatorStageIndex == nil {
 		fmt.Println(colorizer.Red(logsAreNotLoaded))
 		return
 	}
-	if len(aggregatorEntries) == 0 {
+	if aggregatorStageIndex.entries == 0 {
 		fmt.Println(colorizer.Red(emptyLog))
 		return
 	}
-	printMarshalledNotChecked(colorizer, aggregatorEntries)
-}
-
-// PrintAggregatorCheckedNotStored function prints all messages that have been checked but not stored into database for whatever reason
-func PrintAggregatorCheckedNotStored(colorizer aurora.Aurora) {
-	if aggregatorEntries == nil {
-		fmt.Println(colorizer.Red(logsAreNotLoaded))
+	transitions := aggregatorStageIndex.funnel.transitions()
+	if transition < 0 || transition >= len(transitions) {
+		fmt.Println(colorizer.Red(unknownTransition))
 		return
 	}
-	if len(aggregatorEntries) == 0 {
-		fmt.Println(colorizer.Red(emptyLog))
-		return
+	err := printStuckMessages(colorizer, aggregatorStageIndex, transitions[transition], window)
+	if err != nil {
+		fmt.Println(colorizer.Red(err))
 	}
-	printCheckedNotStored(colorizer, aggregatorEntries)
 }
@@ -0,0 +1,217 @@
+// Copyright 2020, 2021, 2022 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package analyser
+
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/ccx-data-pipeline-monitor/packages/analyser/aggregator_breakdown.html
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/logrusorgru/aurora"
+)
+
+// Orders in which the funnel breakdown can be sorted
+const (
+	SortByOrganization = "org"
+	SortByLoss         = "loss"
+	SortByConsumed     = "consumed"
+)
+
+// minimal width of columns with numbers of messages
+const breakdownColumnWidth = 9
+
+// unknownOwner is displayed for messages consumed, but never read, because
+// consume records don't contain organization nor cluster
+const unknownOwner = "unknown"
+
+// BreakdownOptions contains options for aggregator funnel breakdown. When
+// Organization is set, just clusters of given organization are displayed.
+type BreakdownOptions struct {
+	Clusters     bool
+	Organization int
+	SortBy       string
+}
+
+// ownerKey identifies organization or cluster the messages belong to
+type ownerKey struct {
+	organization int
+	cluster      string
+}
+
+// funnelBreakdown contains numbers of messages that reached each stage for
+// one organization or cluster. Loss is the ratio of messages that entered
+// the funnel, but never reached its last stage.
+type funnelBreakdown struct {
+	owner  ownerKey
+	counts []int
+	loss   float64
+}
+
+// computeLoss method computes ratio of messages that reached the first stage
+// of the funnel, but not the last one
+func (breakdown *funnelBreakdown) computeLoss(f *funnel) {
+	entered := breakdown.counts[f.first]
+	if entered == 0 {
+		breakdown.loss = 0
+		return
+	}
+	breakdown.loss = float64(entered-breakdown.counts[f.last]) / float64(entered)
+}
+
+// owner method returns organization and cluster of the message. Messages
+// in stages without owner (for example consume records) are attributed
+// using the first record for the same message that contains the owner.
+func (index *aggregatorIndex) owner(item stageItem) ownerKey {
+	if item.cluster == "" {
+		owner := index.ownerItem(item.key)
+		if owner == nil {
+			return ownerKey{}
+		}
+		item = *owner
+	}
+	return ownerKey{item.organization, item.cluster}
+}
+
+// breakdown method computes funnel statistic for each organization or for
+// each cluster
+func (index *aggregatorIndex) breakdown(window TimeWindow, options BreakdownOptions) []*funnelBreakdown {
+	byOwner := make(map[ownerKey]*funnelBreakdown)
+	perCluster := options.Clusters || options.Organization != 0
+
+	for stage := range index.stages {
+		for _, item := range index.stages[stage].items {
+			if !window.IsUnlimited() && !window.containsNano(index.enteredAt(item)) {
+				continue
+			}
+			owner := index.owner(item)
+			if options.Organization != 0 && owner.organization != options.Organization {
+				continue
+			}
+			if !perCluster {
+				owner.cluster = ""
+			}
+			breakdown, found := byOwner[owner]
+			if !found {
+				breakdown = &funnelBreakdown{owner: owner, counts: make([]int, len(index.stages))}
+				byOwner[owner] = breakdown
+			}
+			breakdown.counts[stage]++
+		}
+	}
+
+	breakdowns := make([]*funnelBreakdown, 0, len(byOwner))
+	for _, breakdown := range byOwner {
+		breakdown.computeLoss(index.funnel)
+		breakdowns = append(breakdowns, breakdown)
+	}
+	sortBreakdowns(breakdowns, options.SortBy, index.funnel.first)
+	return breakdowns
+}
+
+// sortBreakdowns function sorts breakdowns by given criteria. Ties are
+// resolved by organization and cluster, so the output is stable. Messages
+// are counted at the first stage of the funnel.
+func sortBreakdowns(breakdowns []*funnelBreakdown, sortBy string, first int) {
+	byOwner := func(a, b *funnelBreakdown) bool {
+		if a.owner.organization != b.owner.organization {
+			return a.owner.organization < b.owner.organization
+		}
+		return a.owner.cluster < b.owner.cluster
+	}
+
+	sort.Slice(breakdowns, func(i, j int) bool {
+		a, b := breakdowns[i], breakdowns[j]
+		switch sortBy {
+		case SortByLoss:
+			if a.loss != b.loss {
+				return a.loss > b.loss
+			}
+		case SortByConsumed:
+			if a.counts[first] != b.counts[first] {
+				return a.counts[first] > b.counts[first]
+			}
+		}
+		return byOwner(a, b)
+	})
+}
+
+func formatOrganization(organization int) string {
+	if organization == 0 {
+		return unknownOwner
+	}
+	return strconv.Itoa(organization)
+}
+
+func formatCluster(cluster string) string {
+	if cluster == "" {
+		return unknownOwner
+	}
+	return cluster
+}
+
+func printAggregatorBreakdown(colorizer aurora.Aurora, index *aggregatorIndex, window TimeWindow, options BreakdownOptions) {
+	breakdowns := index.breakdown(window, options)
+	perCluster := options.Clusters || options.Organization != 0
+
+	if perCluster {
+		fmt.Printf("%-12s %-36s", "Organization", "Cluster")
+	} else {
+		fmt.Printf("%-12s", "Organization")
+	}
+	widths := make([]int, len(index.stages))
+	for stage := range index.stages {
+		widths[stage] = len(index.funnel.stages[stage].name)
+		if widths[stage] < breakdownColumnWidth {
+			widths[stage] = breakdownColumnWidth
+		}
+		fmt.Printf(" %*s", widths[stage], index.funnel.stages[stage].name)
+	}
+	fmt.Printf(" %7s\n", "Loss")
+
+	for _, breakdown := range breakdowns {
+		fmt.Printf("%-12s", colorizer.Yellow(formatOrganization(breakdown.owner.organization)))
+		if perCluster {
+			fmt.Printf(" %-36s", formatCluster(breakdown.owner.cluster))
+		}
+		for stage, count := range breakdown.counts {
+			fmt.Printf(" %*d", widths[stage], count)
+		}
+
+		loss := fmt.Sprintf("%6.1f%%", 100*breakdown.loss)
+		if breakdown.loss > 0 {
+			fmt.Printf(" %s\n", colorizer.Red(loss))
+		} else {
+			fmt.Printf(" %s\n", colorizer.Green(loss))
+		}
+	}
+	fmt.Println()
+}
+
+// PrintAggregatorBreakdown function prints aggregator funnel statistic for
+// each organization, or for each cluster, within given time window
+func PrintAggregatorBreakdown(colorizer aurora.Aurora, window TimeWindow, options BreakdownOptions) {
+	if aggregatorStageIndex == nil {
+		fmt.Println(colorizer.Red(logsAreNotLoaded))
+		return
+	}
+	if aggregatorStageIndex.entries == 0 {
+		fmt.Println(colorizer.Red(emptyLog))
+		return
+	}
+	printAggregatorBreakdown(colorizer, aggregatorStageIndex, window, options)
+}
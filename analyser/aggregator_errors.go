@@ -0,0 +1,266 @@
+// Copyright 2020, 2021, 2022 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package analyser
+
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/ccx-data-pipeline-monitor/packages/analyser/aggregator_errors.html
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/logrusorgru/aurora"
+)
+
+// DefaultTopErrors is the default number of error templates displayed
+const DefaultTopErrors = 10
+
+// maximum number of organizations and clusters listed for one template
+const affectedOwners = 5
+
+// outsideFunnel is displayed for errors not related to any message that
+// reached the funnel
+const outsideFunnel = "outside funnel"
+
+// errorTemplateRules contains rules used to normalize error strings into
+// templates. Rules are applied in order, so UUIDs and timestamps are
+// replaced before plain numbers.
+var errorTemplateRules = []struct {
+	regexp      *regexp.Regexp
+	replacement string
+}{
+	{clusterIDRegexp, "<uuid>"},
+	{regexp.MustCompile(`\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(?:[.,]\d+)?(?:Z|[+-]\d{2}:?\d{2})?`), "<time>"},
+	{regexp.MustCompile(`\b0x[0-9a-fA-F]+\b|\b[0-9a-fA-F]{16,}\b`), "<hex>"},
+	{regexp.MustCompile(`\b\d+\b`), "<n>"},
+}
+
+// errorTemplate function normalizes error string by replacing IDs,
+// offsets, UUIDs, and timestamps by placeholders
+func errorTemplate(message string) string {
+	for _, rule := range errorTemplateRules {
+		message = rule.regexp.ReplaceAllString(message, rule.replacement)
+	}
+	return strings.TrimSpace(message)
+}
+
+// errorClass contains all error entries with the same template
+type errorClass struct {
+	template      string
+	count         int
+	first         int64
+	last          int64
+	stages        map[string]int
+	organizations map[int]bool
+	clusters      map[string]bool
+}
+
+// add method adds one error entry into the class
+func (class *errorClass) add(item *stageItem, stage string) {
+	class.count++
+	if item.time != 0 && (class.first == 0 || item.time < class.first) {
+		class.first = item.time
+	}
+	if item.time > class.last {
+		class.last = item.time
+	}
+	class.stages[stage]++
+	if item.organization != 0 {
+		class.organizations[item.organization] = true
+	}
+	if item.cluster != "" {
+		class.clusters[item.cluster] = true
+	}
+}
+
+// classifyErrors method groups all error entries logged within given time
+// window by template. The message callback reads error message of the entry
+// stored at given location. Classes are sorted by number of entries.
+func (index *funnelIndex) classifyErrors(window TimeWindow, message func(location int64) (string, error)) ([]*errorClass, error) {
+	classes := []*errorClass{}
+	byTemplate := make(map[string]*errorClass)
+
+	for _, items := range index.errors {
+		for i := range items {
+			item := items[i]
+			if !window.containsNano(item.time) {
+				continue
+			}
+			text, err := message(item.location)
+			if err != nil {
+				return nil, err
+			}
+			template := errorTemplate(text)
+			class := byTemplate[template]
+			if class == nil {
+				class = &errorClass{
+					template:      template,
+					stages:        make(map[string]int),
+					organizations: make(map[int]bool),
+					clusters:      make(map[string]bool),
+				}
+				byTemplate[template] = class
+				classes = append(classes, class)
+			}
+			// error entries usually don't contain owner of the report
+			if item.organization == 0 && item.cluster == "" {
+				if owner := index.ownerItem(item.key); owner != nil {
+					item.organization = owner.organization
+					item.cluster = owner.cluster
+				}
+			}
+			class.add(&item, index.errorStage(item.key))
+		}
+	}
+
+	sort.Slice(classes, func(i, j int) bool {
+		if classes[i].count != classes[j].count {
+			return classes[i].count > classes[j].count
+		}
+		return classes[i].template < classes[j].template
+	})
+	return classes, nil
+}
+
+// classifyAggregatorErrors function reads all error entries logged within
+// given time window and groups them by template
+func classifyAggregatorErrors(index *aggregatorIndex, window TimeWindow) ([]*errorClass, error) {
+	reader, err := index.open()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.close()
+
+	return index.classifyErrors(window, func(location int64) (string, error) {
+		entry, err := reader.entry(location)
+		if err != nil {
+			return "", err
+		}
+		if entry.Error == "" {
+			return entry.Message, nil
+		}
+		return entry.Error, nil
+	})
+}
+
+// formatErrorTime function formats time of error entry
+func formatErrorTime(t int64) string {
+	if t == 0 {
+		return "unknown time"
+	}
+	return time.Unix(0, t).UTC().Format(aggregatorTimeFormat)
+}
+
+// formatAffected function formats sorted list of affected organizations or
+// clusters, just the first few are displayed
+func formatAffected(owners []string) string {
+	if len(owners) == 0 {
+		return unknownOwner
+	}
+	if len(owners) > affectedOwners {
+		return fmt.Sprintf("%s and %d more", strings.Join(owners[:affectedOwners], ", "), len(owners)-affectedOwners)
+	}
+	return strings.Join(owners, ", ")
+}
+
+func printErrorClass(colorizer aurora.Aurora, i int, class *errorClass) {
+	e := strconv.Itoa(i + 1)
+	fmt.Printf("%5s  %s occurrences  %s\n", colorizer.Blue(e), colorizer.Yellow(strconv.Itoa(class.count)), colorizer.Red(class.template))
+
+	stages := make([]string, 0, len(class.stages))
+	for stage, count := range class.stages {
+		stages = append(stages, fmt.Sprintf("%s: %d", stage, count))
+	}
+	sort.Strings(stages)
+
+	organizations := make([]int, 0, len(class.organizations))
+	for organization := range class.organizations {
+		organizations = append(organizations, organization)
+	}
+	sort.Ints(organizations)
+	orgs := make([]string, len(organizations))
+	for i, organization := range organizations {
+		orgs[i] = strconv.Itoa(organization)
+	}
+
+	clusters := make([]string, 0, len(class.clusters))
+	for cluster := range class.clusters {
+		clusters = append(clusters, cluster)
+	}
+	sort.Strings(clusters)
+
+	fmt.Printf("%5s  %-14s %s\n", "", "stages", strings.Join(stages, ", "))
+	fmt.Printf("%5s  %-14s %s\n", "", "first", colorizer.Gray(8, formatErrorTime(class.first)))
+	fmt.Printf("%5s  %-14s %s\n", "", "last", colorizer.Gray(8, formatErrorTime(class.last)))
+	fmt.Printf("%5s  %-14s %s\n", "", "organizations", formatAffected(orgs))
+	fmt.Printf("%5s  %-14s %s\n", "", "clusters", formatAffected(clusters))
+}
+
+func printAggregatorErrors(colorizer aurora.Aurora, index *aggregatorIndex, window TimeWindow, top int) error {
+	classes, err := classifyAggregatorErrors(index, window)
+	if err != nil {
+		return err
+	}
+	printErrorClasses(colorizer, classes, top)
+	return nil
+}
+
+// printErrorClasses function prints total number of errors and the most
+// frequent error classes
+func printErrorClasses(colorizer aurora.Aurora, classes []*errorClass, top int) {
+	if len(classes) == 0 {
+		fmt.Println(colorizer.Green("no errors found"))
+		fmt.Println()
+		return
+	}
+
+	total := 0
+	for _, class := range classes {
+		total += class.count
+	}
+	fmt.Printf("%s errors, %s distinct templates\n", colorizer.Red(strconv.Itoa(total)), colorizer.Blue(strconv.Itoa(len(classes))))
+	fmt.Println()
+
+	for i, class := range classes {
+		if i == top {
+			fmt.Println(colorizer.Gray(8, fmt.Sprintf("%d less frequent templates not displayed", len(classes)-top)))
+			break
+		}
+		printErrorClass(colorizer, i, class)
+	}
+	fmt.Println()
+}
+
+// PrintAggregatorErrors function prints the most frequent templates of
+// errors logged by aggregator within given time window together with funnel
+// stages where they happened and affected organizations and clusters
+func PrintAggregatorErrors(colorizer aurora.Aurora, window TimeWindow, top int) {
+	if aggregatorStageIndex == nil {
+		fmt.Println(colorizer.Red(logsAreNotLoaded))
+		return
+	}
+	if aggregatorStageIndex.entries == 0 {
+		fmt.Println(colorizer.Red(emptyLog))
+		return
+	}
+	err := printAggregatorErrors(colorizer, aggregatorStageIndex, window, top)
+	if err != nil {
+		fmt.Println(colorizer.Red(err))
+	}
+}
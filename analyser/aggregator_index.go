@@ -0,0 +1,184 @@
+// Copyright 2020, 2021, 2022 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package analyser
+
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/ccx-data-pipeline-monitor/packages/analyser/aggregator_index.html
+
+import (
+	"strings"
+)
+
+// stageRef refers to one item of given funnel stage
+type stageRef struct {
+	stage int
+	item  int
+}
+
+// aggregatorIndex contains aggregated information about all aggregator log
+// entries: messages split into funnel stages, error entries indexed by
+// message key, messages indexed by cluster, other entries containing owner
+// of the report, and container restarts. Log entries are not stored in the
+// index, so the index is much smaller than the log file.
+type aggregatorIndex struct {
+	funnelIndex
+	filename  string
+	entries   int
+	byCluster map[string][]stageRef
+	others    []stageItem
+	restarts  []stageItem
+	lines     logLines
+}
+
+var aggregatorStageIndex *aggregatorIndex = nil
+
+// newAggregatorIndex function constructs empty index for given log file.
+// Entries are split into stages of the configured aggregator funnel.
+func newAggregatorIndex(filename string) *aggregatorIndex {
+	return &aggregatorIndex{
+		funnelIndex: newFunnelIndex(aggregatorFunnel),
+		filename:    filename,
+		byCluster:   make(map[string][]stageRef),
+		lines:       newLogLines(),
+	}
+}
+
+// item method returns index item for the entry stored at given location
+func (index *aggregatorIndex) item(entry *AggregatorLogEntry, key messageKey, location int64) stageItem {
+	return stageItem{
+		key:          key,
+		location:     location,
+		time:         unixNano(entry.Timestamp),
+		organization: entry.Organization,
+		cluster:      index.intern(entry.Cluster),
+		pod:          index.intern(entry.Pod),
+	}
+}
+
+// add method updates the index by one log entry stored at given location.
+// All fields of the entry are used to find funnel stage of the entry.
+func (index *aggregatorIndex) add(entry *AggregatorLogEntry, fields logFields, location int64) {
+	index.entries++
+	index.lastPod = index.intern(entry.Pod)
+	index.lastTime = unixNano(entry.Timestamp)
+
+	stage, ok := index.funnel.classify(fields)
+	key := index.key(stage, fields)
+
+	if entry.Message == containerRestarted {
+		index.restarts = append(index.restarts, index.item(entry, key, location))
+		delete(index.processing, entry.Pod)
+		return
+	}
+
+	if entry.Level == entryLevelError {
+		index.addError(index.item(entry, key, location))
+	}
+
+	if !ok {
+		// entries outside the funnel are kept when they contain owner of
+		// the report, so they can be found for the customer
+		if entry.Level != entryLevelError && (entry.Organization != 0 || entry.Cluster != "") {
+			index.others = append(index.others, index.item(entry, key, location))
+		}
+		return
+	}
+	item := index.item(entry, key, location)
+	// messages are indexed by cluster at the first stage that knows it
+	if owner := index.ownerItem(key); item.cluster != "" && (owner == nil || owner.cluster == "") {
+		cluster := strings.ToLower(item.cluster)
+		index.byCluster[cluster] = append(index.byCluster[cluster], stageRef{stage, len(index.stages[stage].items)})
+	}
+	index.addItem(stage, item)
+}
+
+// restartAfter method returns the first restart of container that processed
+// the message after the message reached the stage, or nil if the container
+// has not been restarted since then
+func (index *aggregatorIndex) restartAfter(item stageItem) *stageItem {
+	if item.pod == "" {
+		return nil
+	}
+	for i := range index.restarts {
+		restart := &index.restarts[i]
+		if restart.pod == item.pod && restart.time >= item.time {
+			return restart
+		}
+	}
+	return nil
+}
+
+// lostInRestarts method returns number of messages consumed, but never
+// stored, for each container restart that interrupted their processing
+func (index *aggregatorIndex) lostInRestarts() map[*stageItem]int {
+	lost := make(map[*stageItem]int)
+	if len(index.restarts) == 0 {
+		return lost
+	}
+
+	for _, item := range index.stages[index.funnel.first].items {
+		if index.stages[index.funnel.last].contains(item.key) {
+			continue
+		}
+		restart := index.restartAfter(item)
+		if restart != nil {
+			lost[restart]++
+		}
+	}
+	return lost
+}
+
+// aggregatorReader reads log entries referenced from the index
+type aggregatorReader struct {
+	*logReader
+}
+
+func (index *aggregatorIndex) open() (aggregatorReader, error) {
+	reader, err := openLogReader(index.filename)
+	return aggregatorReader{reader}, err
+}
+
+// entry method reads and parses log entry stored at given location
+func (reader aggregatorReader) entry(location int64) (*AggregatorLogEntry, error) {
+	line, err := reader.line(location)
+	if err != nil {
+		return nil, err
+	}
+	entry, err := parseAggregatorLogEntry(line)
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// scan method processes one line of aggregator log file stored at given
+// location
+func (index *aggregatorIndex) scan(line string, location int64) {
+	block := index.lines.scan(line, location, func(line string) error {
+		entry, err := parseAggregatorLogEntry(line)
+		if err != nil {
+			return err
+		}
+		fields, err := parseLogFields(line)
+		if err != nil {
+			return err
+		}
+		index.add(&entry, fields, location)
+		return nil
+	})
+	if block != nil {
+		block.context = index.crashContext()
+	}
+}
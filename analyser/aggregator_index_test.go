@@ -0,0 +1,290 @@
+// Copyright 2020, 2021, 2022 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package analyser
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/logrusorgru/aurora"
+)
+
+// number of messages in generated aggregator log, each message produces up
+// to six funnel entries and one error entry
+var benchmarkMessages = flag.Int("benchmark-messages", 100000, "number of messages in log generated for benchmarks")
+
+// generated log is shared by all benchmarks
+var (
+	benchmarkLogOnce sync.Once
+	benchmarkLogDir  string
+	benchmarkLogFile string
+	benchmarkLogErr  error
+)
+
+// aggregatorStageMessages contains messages of default aggregator funnel
+// stages that follow the consume stage
+var aggregatorStageMessages = []string{"Read", "Organization whitelisted", "Marshalled", "Time ok", "Stored"}
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	code := m.Run()
+	if benchmarkLogDir != "" {
+		_ = os.RemoveAll(benchmarkLogDir)
+	}
+	os.Exit(code)
+}
+
+// writeAggregatorLog function generates aggregator log with given number of
+// messages. Every tenth message gets stuck after one of the first five
+// stages, so all transitions of the funnel contain stuck messages. Stuck
+// messages are followed by error entry.
+func writeAggregatorLog(filename string, messages int) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(file)
+	start := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	for i := 0; i < messages; i++ {
+		t := start.Add(time.Duration(i) * time.Millisecond).Format(aggregatorTimeFormat)
+		partition := i % 4
+		offset := i / 4
+		organization := i%1000 + 1
+		cluster := fmt.Sprintf("%08x-0000-4000-8000-%012x", i%5000, i)
+		pod := fmt.Sprintf("aggregator-%d", partition)
+
+		fmt.Fprintf(writer, `{"level":"info","time":%q,"message":"Consumed","topic":"ccx.ocp.results","offset":%d,"group":"aggregator","partition":%d,"pod":%q}`+"\n", t, offset, partition, pod)
+		stages := len(aggregatorStageMessages)
+		if i%10 == 0 {
+			stages = i / 10 % len(aggregatorStageMessages)
+		}
+		for _, message := range aggregatorStageMessages[:stages] {
+			fmt.Fprintf(writer, `{"level":"info","time":%q,"message":%q,"topic":"ccx.ocp.results","offset":%d,"partition":%d,"organization":%d,"cluster":%q,"pod":%q}`+"\n", t, message, offset, partition, organization, cluster, pod)
+		}
+		if stages < len(aggregatorStageMessages) {
+			fmt.Fprintf(writer, `{"level":"error","time":%q,"message":"Error processing message","error":"report for cluster %s is invalid","topic":"ccx.ocp.results","offset":%d,"partition":%d,"pod":%q}`+"\n", t, cluster, offset, partition, pod)
+		}
+	}
+
+	err = writer.Flush()
+	closeErr := file.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+// benchmarkLog function returns name of generated aggregator log
+func benchmarkLog(b *testing.B) string {
+	benchmarkLogOnce.Do(func() {
+		benchmarkLogDir, benchmarkLogErr = os.MkdirTemp("", "aggregator-benchmark")
+		if benchmarkLogErr != nil {
+			return
+		}
+		benchmarkLogFile = filepath.Join(benchmarkLogDir, "aggregator.log")
+		benchmarkLogErr = writeAggregatorLog(benchmarkLogFile, *benchmarkMessages)
+	})
+	if benchmarkLogErr != nil {
+		b.Fatal(benchmarkLogErr)
+	}
+	return benchmarkLogFile
+}
+
+// benchmarkIndex function reads index of generated aggregator log
+func benchmarkIndex(b *testing.B) *aggregatorIndex {
+	index, err := readAggregatorLogFile(benchmarkLog(b))
+	if err != nil {
+		b.Fatal(err)
+	}
+	return index
+}
+
+// discardStdout function redirects standard output, that is used by print
+// functions, until the benchmark ends
+func discardStdout(b *testing.B) {
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		b.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = devNull
+	b.Cleanup(func() {
+		os.Stdout = stdout
+		_ = devNull.Close()
+	})
+}
+
+func BenchmarkAggregatorIndexScan(b *testing.B) {
+	filename := benchmarkLog(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := readAggregatorLogFile(filename)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkAggregatorIndexAdd(b *testing.B) {
+	type parsedLine struct {
+		entry    AggregatorLogEntry
+		fields   logFields
+		location int64
+	}
+	parsed := []parsedLine{}
+	err := scanLogFile(benchmarkLog(b), func(line string, location int64) {
+		entry, err := parseAggregatorLogEntry(line)
+		if err != nil {
+			b.Fatal(err)
+		}
+		fields, err := parseLogFields(line)
+		if err != nil {
+			b.Fatal(err)
+		}
+		parsed = append(parsed, parsedLine{entry, fields, location})
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		index := newAggregatorIndex("aggregator.log")
+		for j := range parsed {
+			index.add(&parsed[j].entry, parsed[j].fields, parsed[j].location)
+		}
+	}
+}
+
+func BenchmarkAggregatorStatistic(b *testing.B) {
+	index := benchmarkIndex(b)
+	colorizer := aurora.NewAurora(false)
+	discardStdout(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		printAggregatorStatistic(colorizer, index, TimeWindow{})
+	}
+}
+
+// BenchmarkAggregatorStuckMessages function measures all drill-downs of
+// the default funnel, that is messages stuck after consume, read,
+// whitelist, marshal, and check stages
+func BenchmarkAggregatorStuckMessages(b *testing.B) {
+	index := benchmarkIndex(b)
+	colorizer := aurora.NewAurora(false)
+	discardStdout(b)
+
+	for _, transition := range index.funnel.transitions() {
+		transition := transition
+		b.Run(index.funnel.describe(transition), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				err := printStuckMessages(colorizer, index, transition, TimeWindow{})
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestStageSetFind(t *testing.T) {
+	set := stageSet{byKey: make(map[string][]int)}
+	set.add(stageItem{key: messageKey{"", "topic-a", "0", "10"}, location: 1})
+	set.add(stageItem{key: messageKey{"", "topic-a", "1", "10"}, location: 2})
+	set.add(stageItem{key: messageKey{"", "", "", "20"}, location: 3})
+
+	tests := []struct {
+		name     string
+		key      messageKey
+		location int64
+	}{
+		{"exact match", messageKey{"", "topic-a", "1", "10"}, 2},
+		{"first of several offsets", messageKey{"", "topic-a", "0", "10"}, 1},
+		{"missing partition matches any", messageKey{"", "topic-a", "", "10"}, 1},
+		{"item without topic matches any topic", messageKey{"", "topic-b", "3", "20"}, 3},
+		{"different partition", messageKey{"", "topic-a", "2", "10"}, 0},
+		{"different topic", messageKey{"", "topic-b", "0", "10"}, 0},
+		{"unknown offset", messageKey{"", "topic-a", "0", "30"}, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			item := set.find(test.key)
+			if test.location == 0 {
+				if item != nil || set.contains(test.key) {
+					t.Errorf("expected no item for key %v", test.key)
+				}
+				return
+			}
+			if item == nil || !set.contains(test.key) {
+				t.Fatalf("expected item at location %d, found none", test.location)
+			}
+			if item.location != test.location {
+				t.Errorf("expected item at location %d, found item at location %d", test.location, item.location)
+			}
+		})
+	}
+}
+
+func TestAggregatorIndexStuckAfter(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "aggregator.log")
+	err := writeAggregatorLog(filename, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, err := readAggregatorLogFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// every tenth message gets stuck, stuck stages are repeated with
+	// period of five, so there are two stuck messages after each stage
+	transitions := index.funnel.transitions()
+	if len(transitions) != len(aggregatorStageMessages) {
+		t.Fatalf("expected %d transitions, got %d", len(aggregatorStageMessages), len(transitions))
+	}
+	for i, transition := range transitions {
+		t.Run(index.funnel.describe(transition), func(t *testing.T) {
+			stuck := index.stuckAfter(transition[0], transition[1], TimeWindow{})
+			if len(stuck) != 2 {
+				t.Fatalf("expected 2 stuck messages, got %d", len(stuck))
+			}
+			for _, item := range stuck {
+				if len(index.errorsFor(item.key)) != 1 {
+					t.Errorf("expected one error for stuck message %v", item.key)
+				}
+				if index.find(transition[0], item.key) == nil {
+					t.Errorf("stuck message %v has not reached stage %d", item.key, i)
+				}
+			}
+		})
+	}
+
+	// window that ends before the first stuck message contains no stuck
+	// messages
+	start := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	window := TimeWindow{Until: start.Add(-time.Second)}
+	stuck := index.stuckAfter(transitions[0][0], transitions[0][1], window)
+	if len(stuck) != 0 {
+		t.Errorf("expected no stuck messages before the log starts, got %d", len(stuck))
+	}
+}
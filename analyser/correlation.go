@@ -0,0 +1,258 @@
+// Copyright 2020, 2021, 2022 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package analyser
+
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/ccx-data-pipeline-monitor/packages/analyser/correlation.html
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/logrusorgru/aurora"
+)
+
+// ReportTrace represents one report sent by CCX data pipeline together with
+// aggregator records describing how the report has been consumed, read, and
+// stored.
+type ReportTrace struct {
+	Pipeline *PipelineTrace
+	Sent     *PipelineLogEntry
+	Consumed *AggregatorLogEntry
+	Read     *AggregatorLogEntry
+	Stored   *AggregatorLogEntry
+
+	// names of aggregator stages the records belong to
+	stages [3]string
+}
+
+// Latency method returns time between sending the report by CCX data
+// pipeline and storing it by aggregator. False is returned when the report
+// has not been stored or when timestamps can't be parsed.
+func (report *ReportTrace) Latency() (time.Duration, bool) {
+	if report.Stored == nil || report.Sent.Timestamp.IsZero() || report.Stored.Timestamp.IsZero() {
+		return 0, false
+	}
+	return report.Stored.Timestamp.Sub(report.Sent.Timestamp), true
+}
+
+// LastStage method returns the last aggregator stage reached by the report
+func (report *ReportTrace) LastStage() string {
+	switch {
+	case report.Stored != nil:
+		return report.stages[2]
+	case report.Read != nil:
+		return report.stages[1]
+	case report.Consumed != nil:
+		return report.stages[0]
+	}
+	return "none"
+}
+
+// notBefore function checks whether aggregator entry has been produced at
+// the same time or after the pipeline entry. When any timestamp can't be
+// parsed, the order of entries can't be decided and true is returned.
+func notBefore(entry *AggregatorLogEntry, sent *PipelineLogEntry) bool {
+	if entry.Timestamp.IsZero() || sent.Timestamp.IsZero() {
+		return true
+	}
+	return !entry.Timestamp.Before(sent.Timestamp)
+}
+
+// correlateReports function matches reports sent by CCX data pipeline with
+// records produced by aggregator for the same cluster and organization.
+// Reports are sent at the pipeline stage marked for correlation. Reports of
+// one cluster and aggregator records are matched in the order they were
+// produced, so each record is assigned to at most one report.
+func correlateReports(pipeline *pipelineIndex, aggregator *aggregatorIndex) ([]ReportTrace, error) {
+	sentStage := pipeline.funnel.correlated()
+	if sentStage == noStage {
+		return nil, fmt.Errorf("no CCX data pipeline funnel stage is marked for correlation")
+	}
+
+	pipelineLog, err := pipeline.open()
+	if err != nil {
+		return nil, err
+	}
+	defer pipelineLog.close()
+
+	aggregatorLog, err := aggregator.open()
+	if err != nil {
+		return nil, err
+	}
+	defer aggregatorLog.close()
+
+	// first read record not assigned to any report yet for each cluster
+	cursors := make(map[string]int)
+	first := aggregator.funnel.first
+	last := aggregator.funnel.last
+
+	// reports are matched in the order they were sent, that can differ
+	// from the order their processing started in when more pods are used
+	sentTraces := []*PipelineTrace{}
+	for _, trace := range pipeline.traces {
+		if trace.has(sentStage) && trace.ClusterID != "" {
+			sentTraces = append(sentTraces, trace)
+		}
+	}
+	sort.SliceStable(sentTraces, func(i, j int) bool {
+		return sentTraces[i].steps[sentStage] < sentTraces[j].steps[sentStage]
+	})
+
+	reports := []ReportTrace{}
+	for _, trace := range sentTraces {
+		sent, err := pipelineLog.entry(trace.steps[sentStage])
+		if err != nil {
+			return nil, err
+		}
+		report := ReportTrace{
+			Pipeline: trace,
+			Sent:     sent,
+		}
+
+		candidates := aggregator.byCluster[trace.ClusterID]
+		for i := cursors[trace.ClusterID]; i < len(candidates); i++ {
+			ref := candidates[i]
+			item := aggregator.stages[ref.stage].items[ref.item]
+			candidate, err := aggregatorLog.entry(item.location)
+			if err != nil {
+				return nil, err
+			}
+			if trace.Organization != 0 && candidate.Organization != trace.Organization {
+				continue
+			}
+			if !notBefore(candidate, sent) {
+				continue
+			}
+			report.Read = candidate
+			report.stages = [3]string{
+				aggregator.funnel.stages[first].name,
+				aggregator.funnel.stages[ref.stage].name,
+				aggregator.funnel.stages[last].name,
+			}
+			report.Consumed, err = findAggregatorEntry(aggregatorLog, aggregator, first, item.key)
+			if err != nil {
+				return nil, err
+			}
+			report.Stored, err = findAggregatorEntry(aggregatorLog, aggregator, last, item.key)
+			if err != nil {
+				return nil, err
+			}
+			cursors[trace.ClusterID] = i + 1
+			break
+		}
+		reports = append(reports, report)
+	}
+
+	return reports, nil
+}
+
+// findAggregatorEntry function reads log entry for message with given key
+// that reached given stage. Nil is returned when the stage was not reached.
+func findAggregatorEntry(reader aggregatorReader, index *aggregatorIndex, stage int, key messageKey) (*AggregatorLogEntry, error) {
+	item := index.find(stage, key)
+	if item == nil {
+		return nil, nil
+	}
+	return reader.entry(item.location)
+}
+
+func printReportTrace(colorizer aurora.Aurora, i int, report *ReportTrace) {
+	e := strconv.Itoa(i)
+	fmt.Printf("%5s  %s  %d  %s  last stage: %s\n", colorizer.Blue(e), colorizer.Gray(8, report.Sent.Time), colorizer.Yellow(report.Pipeline.Organization), report.Pipeline.ClusterID, colorizer.Red(report.LastStage()))
+}
+
+// reportsSentWithin function returns all reports sent within given time
+// window. Reports need to be correlated before filtering, otherwise
+// aggregator records of reports sent before the window would be assigned to
+// reports sent within the window.
+func reportsSentWithin(reports []ReportTrace, window TimeWindow) []ReportTrace {
+	if window.IsUnlimited() {
+		return reports
+	}
+
+	filtered := []ReportTrace{}
+	for _, report := range reports {
+		if window.contains(report.Sent.Timestamp) {
+			filtered = append(filtered, report)
+		}
+	}
+	return filtered
+}
+
+func printReportsCorrelation(colorizer aurora.Aurora, pipeline *pipelineIndex, aggregator *aggregatorIndex, window TimeWindow) error {
+	reports, err := correlateReports(pipeline, aggregator)
+	if err != nil {
+		return err
+	}
+	reports = reportsSentWithin(reports, window)
+
+	notStored := []ReportTrace{}
+	var total, maximum time.Duration
+	measured := 0
+
+	for i := range reports {
+		latency, ok := reports[i].Latency()
+		if reports[i].Stored == nil {
+			notStored = append(notStored, reports[i])
+			continue
+		}
+		if ok {
+			total += latency
+			measured++
+			if latency > maximum {
+				maximum = latency
+			}
+		}
+	}
+
+	fmt.Printf("%-20s %s\n", "Sent reports", colorizer.Blue(strconv.Itoa(len(reports))))
+	fmt.Printf("%-20s %s\n", "Stored reports", colorizer.Green(strconv.Itoa(len(reports)-len(notStored))))
+	fmt.Printf("%-20s %s\n", "Not stored reports", colorizer.Red(strconv.Itoa(len(notStored))))
+	if measured > 0 {
+		fmt.Printf("%-20s %s\n", "Average latency", colorizer.Blue(total/time.Duration(measured)))
+		fmt.Printf("%-20s %s\n", "Maximum latency", colorizer.Blue(maximum))
+	}
+	fmt.Println()
+
+	if len(notStored) > 0 {
+		fmt.Println(colorizer.Magenta("Sent but not stored"))
+	}
+	for i := range notStored {
+		printReportTrace(colorizer, i+1, &notStored[i])
+	}
+	fmt.Println()
+	return nil
+}
+
+// PrintReportsCorrelation function matches reports sent by CCX data pipeline
+// with aggregator records, prints end-to-end latency, and lists all reports
+// that have been sent within given time window but never stored.
+func PrintReportsCorrelation(colorizer aurora.Aurora, window TimeWindow) {
+	if pipelineStageIndex == nil || aggregatorStageIndex == nil {
+		fmt.Println(colorizer.Red(logsAreNotLoaded))
+		return
+	}
+	if pipelineStageIndex.entries == 0 || aggregatorStageIndex.entries == 0 {
+		fmt.Println(colorizer.Red(emptyLog))
+		return
+	}
+	err := printReportsCorrelation(colorizer, pipelineStageIndex, aggregatorStageIndex, window)
+	if err != nil {
+		fmt.Println(colorizer.Red(err))
+	}
+}
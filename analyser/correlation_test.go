@@ -0,0 +1,90 @@
+// Copyright 2020, 2021, 2022 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package analyser
+
+import (
+	"fmt"
+	"testing"
+)
+
+// aggregatorLines function constructs entries logged by aggregator for
+// report of the test cluster consumed at given offset. Given number of stages
+// following the consume stage are logged.
+func aggregatorLines(offset int, time string, stages int) []string {
+	lines := []string{
+		fmt.Sprintf(`{"level":"info","time":%q,"message":"Consumed","topic":"ccx.ocp.results","offset":%d,"group":"aggregator","partition":0}`, time, offset),
+	}
+	for _, message := range aggregatorStageMessages[:stages] {
+		lines = append(lines, fmt.Sprintf(`{"level":"info","time":%q,"message":%q,"topic":"ccx.ocp.results","offset":%d,"partition":0,"organization":1,"cluster":%q}`, time, message, offset, testClusterID))
+	}
+	return lines
+}
+
+func TestCorrelateReportsOfOneCluster(t *testing.T) {
+	// the first archive is sent after the second one, that has been
+	// received later by another pod
+	pipelineLines := []string{
+		pipelineLine("pipeline-1", 0, "JSON schema validated"),
+		pipelineLine("pipeline-1", 0, "Downloading https://s3.example.com/archive-1"),
+		pipelineLine("pipeline-2", 1, "JSON schema validated"),
+		pipelineLine("pipeline-2", 1, "Downloading https://s3.example.com/archive-2"),
+		pipelineLine("pipeline-2", 1, "Saved https://s3.example.com/archive-2"),
+		pipelineLine("pipeline-2", 2, sendingMessage),
+		pipelineLine("pipeline-2", 2, "Message has been sent successfully"),
+		pipelineLine("pipeline-1", 3, "Saved https://s3.example.com/archive-1"),
+		pipelineLine("pipeline-1", 3, sendingMessage),
+		pipelineLine("pipeline-1", 3, "Message has been sent successfully"),
+	}
+	pipelineLines = append(pipelineLines, archiveLines("pipeline-2", 5, "https://s3.example.com/archive-3")...)
+
+	aggregatorLog := []string{}
+	aggregatorLog = append(aggregatorLog, aggregatorLines(0, "2022-03-01T10:00:02.5Z", len(aggregatorStageMessages))...)
+	aggregatorLog = append(aggregatorLog, aggregatorLines(1, "2022-03-01T10:00:03.5Z", 1)...)
+	aggregatorLog = append(aggregatorLog, aggregatorLines(2, "2022-03-01T10:00:06Z", len(aggregatorStageMessages))...)
+
+	pipeline, err := readPipelineLogFile(writeLines(t, "pipeline.log", pipelineLines...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	aggregator, err := readAggregatorLogFile(writeLines(t, "aggregator.log", aggregatorLog...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reports, err := correlateReports(pipeline, aggregator)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []struct {
+		url   string
+		stage string
+	}{
+		{"https://s3.example.com/archive-2", "Stored"},
+		{"https://s3.example.com/archive-1", "Read"},
+		{"https://s3.example.com/archive-3", "Stored"},
+	}
+	if len(reports) != len(expected) {
+		t.Fatalf("expected %d reports, got %d", len(expected), len(reports))
+	}
+	for i, report := range reports {
+		if report.Pipeline.URL != expected[i].url {
+			t.Errorf("report %d: expected archive %s, got %s", i, expected[i].url, report.Pipeline.URL)
+		}
+		if stage := report.LastStage(); stage != expected[i].stage {
+			t.Errorf("report %d of %s: expected last stage %s, got %s", i, report.Pipeline.URL, expected[i].stage, stage)
+		}
+	}
+}
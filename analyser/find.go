@@ -0,0 +1,316 @@
+// Copyright 2020, 2021, 2022 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package analyser
+
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/ccx-data-pipeline-monitor/packages/analyser/find.html
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/logrusorgru/aurora"
+)
+
+// Sources of log entries found for one customer
+const (
+	sourceAggregator = "aggregator"
+	sourcePipeline   = "pipeline"
+)
+
+// customer identifies organization or cluster whose entries are searched
+// for. Zero organization or empty cluster matches anything.
+type customer struct {
+	organization int
+	cluster      string
+}
+
+func (c customer) matches(organization int, cluster string) bool {
+	if c.organization != 0 && organization != c.organization {
+		return false
+	}
+	if c.cluster != "" && !strings.EqualFold(cluster, c.cluster) {
+		return false
+	}
+	return true
+}
+
+// foundEntry represents one log entry found for the customer. For aggregator
+// entries in funnel stages the message key is remembered, so related errors
+// can be printed. Text attached to other aggregator entries, like stack
+// trace, is printed with the entry.
+type foundEntry struct {
+	source    string
+	stage     string
+	timestamp int64
+	entryTime string
+	message   string
+	pod       string
+	file      string
+	key       *messageKey
+	location  int64
+	attached  bool
+}
+
+// findAggregatorEntries function returns all aggregator entries that belong
+// to the customer: entries in funnel stages, error entries, and other
+// entries containing owner of the report. Consume records and error entries
+// don't need to contain organization nor cluster, so the read record for
+// the same message is used. Errors related to found messages in funnel
+// stages are printed together with the messages, so they are not returned.
+func findAggregatorEntries(index *aggregatorIndex, who customer, window TimeWindow) ([]foundEntry, error) {
+	found := []foundEntry{}
+
+	reader, err := index.open()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.close()
+
+	keys := make(map[messageKey]bool)
+	for stage := range index.stages {
+		for _, item := range index.stages[stage].items {
+			owner := index.owner(item)
+			if owner == (ownerKey{}) || !who.matches(owner.organization, owner.cluster) {
+				continue
+			}
+			if !window.containsNano(item.time) {
+				continue
+			}
+			entry, err := reader.entry(item.location)
+			if err != nil {
+				return nil, err
+			}
+			key := item.key
+			found = append(found, foundEntry{
+				source:    sourceAggregator,
+				stage:     index.funnel.stages[stage].name,
+				timestamp: item.time,
+				entryTime: entry.Time,
+				message:   fmt.Sprintf("%s  %s  %d", entry.Topic, formatPartition(entry.Partition), entry.Offset),
+				pod:       entry.Pod,
+				file:      entry.SourceFile,
+				key:       &key,
+			})
+			keys[key] = true
+		}
+	}
+
+	printed := make(map[int64]bool)
+	for key := range keys {
+		for _, item := range index.errorsFor(key) {
+			printed[item.location] = true
+		}
+	}
+	others := append([]stageItem{}, index.others...)
+	for _, items := range index.errors {
+		for _, item := range items {
+			if !printed[item.location] {
+				others = append(others, item)
+			}
+		}
+	}
+	sort.Slice(others, func(i, j int) bool {
+		return others[i].location < others[j].location
+	})
+
+	for _, item := range others {
+		owner := index.owner(item)
+		if owner == (ownerKey{}) {
+			owner = ownerKey{item.organization, item.cluster}
+		}
+		if owner == (ownerKey{}) || !who.matches(owner.organization, owner.cluster) {
+			continue
+		}
+		if !window.containsNano(item.time) {
+			continue
+		}
+		entry, err := reader.entry(item.location)
+		if err != nil {
+			return nil, err
+		}
+		message := entry.Message
+		if entry.Error != "" {
+			message += ": " + entry.Error
+		}
+		found = append(found, foundEntry{
+			source:    sourceAggregator,
+			stage:     entry.Level,
+			timestamp: item.time,
+			entryTime: entry.Time,
+			message:   message,
+			pod:       entry.Pod,
+			file:      entry.SourceFile,
+			location:  item.location,
+			attached:  true,
+		})
+	}
+	return found, nil
+}
+
+// findPipelineEntries function returns all entries from CCX data pipeline
+// traces that belong to the customer, including error entries
+func findPipelineEntries(index *pipelineIndex, who customer, window TimeWindow) ([]foundEntry, error) {
+	found := []foundEntry{}
+
+	reader, err := index.open()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.close()
+
+	add := func(location int64, stage string) error {
+		entry, err := reader.entry(location)
+		if err != nil {
+			return err
+		}
+		if !window.contains(entry.Timestamp) {
+			return nil
+		}
+		found = append(found, foundEntry{
+			source:    sourcePipeline,
+			stage:     stage,
+			timestamp: unixNano(entry.Timestamp),
+			entryTime: entry.Time,
+			message:   entry.Message,
+			pod:       entry.Pod,
+			file:      entry.SourceFile,
+		})
+		return nil
+	}
+
+	for _, trace := range index.traces {
+		if trace.Organization == 0 && trace.ClusterID == "" {
+			continue
+		}
+		if !who.matches(trace.Organization, trace.ClusterID) {
+			continue
+		}
+		for stage, location := range trace.steps {
+			if location == notLogged {
+				continue
+			}
+			err := add(location, index.funnel.stages[stage].name)
+			if err != nil {
+				return nil, err
+			}
+		}
+		for _, location := range trace.errors {
+			err := add(location, pipelineLevelError)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return found, nil
+}
+
+func printFoundEntry(colorizer aurora.Aurora, i int, entry *foundEntry) {
+	e := strconv.Itoa(i)
+	message := entry.message
+	if entry.stage == pipelineLevelError || entry.stage == entryLevelError {
+		message = colorizer.Red(message).String()
+	}
+	fmt.Printf("%5s  %s  %-10s  %-26s  %s", colorizer.Blue(e), colorizer.Gray(8, entry.entryTime), colorizer.Cyan(entry.source), colorizer.Yellow(entry.stage), message)
+	printEntrySource(colorizer, entry.pod, entry.file)
+}
+
+// printCustomerEntries function prints all entries found for the customer
+// in time order. Errors related to aggregator messages are printed just
+// once, after the first entry for each message.
+func printCustomerEntries(colorizer aurora.Aurora, who customer, window TimeWindow) error {
+	found := []foundEntry{}
+
+	if aggregatorStageIndex != nil {
+		entries, err := findAggregatorEntries(aggregatorStageIndex, who, window)
+		if err != nil {
+			return err
+		}
+		found = append(found, entries...)
+	}
+	if pipelineStageIndex != nil {
+		entries, err := findPipelineEntries(pipelineStageIndex, who, window)
+		if err != nil {
+			return err
+		}
+		found = append(found, entries...)
+	}
+
+	sort.SliceStable(found, func(i, j int) bool {
+		return found[i].timestamp < found[j].timestamp
+	})
+
+	var reader aggregatorReader
+	if aggregatorStageIndex != nil {
+		var err error
+		reader, err = aggregatorStageIndex.open()
+		if err != nil {
+			return err
+		}
+		defer reader.close()
+	}
+
+	printed := make(map[messageKey]bool)
+	for i := range found {
+		printFoundEntry(colorizer, i+1, &found[i])
+		if found[i].attached {
+			err := printAttachedText(colorizer, reader.logReader, &aggregatorStageIndex.lines, found[i].location)
+			if err != nil {
+				return err
+			}
+		}
+
+		key := found[i].key
+		if key == nil || printed[*key] {
+			continue
+		}
+		printed[*key] = true
+		err := printErrorsForMessageWithKey(colorizer, reader, aggregatorStageIndex, *key)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(found) == 0 {
+		fmt.Println(colorizer.Red("no entries found"))
+	}
+	fmt.Println()
+	return nil
+}
+
+func printCustomer(colorizer aurora.Aurora, who customer, window TimeWindow) {
+	if aggregatorStageIndex == nil && pipelineStageIndex == nil {
+		fmt.Println(colorizer.Red(logsAreNotLoaded))
+		return
+	}
+	err := printCustomerEntries(colorizer, who, window)
+	if err != nil {
+		fmt.Println(colorizer.Red(err))
+	}
+}
+
+// PrintOrganizationEntries function prints all aggregator and CCX data
+// pipeline entries for given organization in time order
+func PrintOrganizationEntries(colorizer aurora.Aurora, organization int, window TimeWindow) {
+	printCustomer(colorizer, customer{organization: organization}, window)
+}
+
+// PrintClusterEntries function prints all aggregator and CCX data pipeline
+// entries for given cluster in time order
+func PrintClusterEntries(colorizer aurora.Aurora, cluster string, window TimeWindow) {
+	printCustomer(colorizer, customer{cluster: cluster}, window)
+}
@@ -0,0 +1,78 @@
+// Copyright 2020, 2021, 2022 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package analyser
+
+import (
+	"testing"
+)
+
+func TestFindAggregatorEntries(t *testing.T) {
+	const otherCluster = "0b3ca4a6-2d5c-4f5e-9a1b-3c6e2f8d4a10"
+	lines := []string{
+		`{"level":"info","time":"2022-03-01T10:00:00Z","message":"Consumed","topic":"ccx.ocp.results","offset":0,"group":"aggregator","partition":0}`,
+		`{"level":"info","time":"2022-03-01T10:00:00Z","message":"Read","topic":"ccx.ocp.results","offset":0,"partition":0,"organization":1,"cluster":"` + testClusterID + `"}`,
+		// printed together with the message
+		`{"level":"error","time":"2022-03-01T10:00:00Z","message":"Error processing message","error":"report is invalid","topic":"ccx.ocp.results","offset":0,"partition":0}`,
+		// entries outside funnel stages
+		`{"level":"warn","time":"2022-03-01T10:00:01Z","message":"Organization not whitelisted","topic":"ccx.ocp.results","offset":1,"partition":0,"organization":1,"cluster":"` + testClusterID + `"}`,
+		`{"level":"error","time":"2022-03-01T10:00:02Z","message":"Unable to store report","error":"database is down","topic":"ccx.ocp.results","offset":1,"partition":0,"organization":1,"cluster":"` + testClusterID + `"}`,
+		`{"level":"warn","time":"2022-03-01T10:00:03Z","message":"Organization not whitelisted","topic":"ccx.ocp.results","offset":2,"partition":0,"organization":2,"cluster":"` + otherCluster + `"}`,
+	}
+	index, err := readAggregatorLogFile(writeLines(t, "aggregator.log", lines...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		who      customer
+		expected []string
+	}{
+		{"organization", customer{organization: 1}, []string{
+			"Consumed", "Read", entryLevelWarning, entryLevelError,
+		}},
+		{"cluster", customer{cluster: testClusterID}, []string{
+			"Consumed", "Read", entryLevelWarning, entryLevelError,
+		}},
+		{"other cluster", customer{cluster: otherCluster}, []string{
+			entryLevelWarning,
+		}},
+		{"unknown organization", customer{organization: 3}, []string{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			found, err := findAggregatorEntries(index, test.who, TimeWindow{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(found) != len(test.expected) {
+				t.Fatalf("expected %d entries, got %d: %+v", len(test.expected), len(found), found)
+			}
+			for i, entry := range found {
+				if entry.stage != test.expected[i] {
+					t.Errorf("entry %d: expected %s, got %s", i, test.expected[i], entry.stage)
+				}
+			}
+		})
+	}
+
+	found, err := findAggregatorEntries(index, customer{organization: 1}, TimeWindow{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if message := found[len(found)-1].message; message != "Unable to store report: database is down" {
+		t.Errorf("unexpected error message '%s'", message)
+	}
+}
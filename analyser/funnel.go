@@ -0,0 +1,443 @@
+// Copyright 2020, 2021, 2022 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package analyser
+
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/ccx-data-pipeline-monitor/packages/analyser/funnel.html
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/RedHatInsights/ccx-data-pipeline-monitor/config"
+)
+
+// maxKeyFields is the maximum number of key fields of one funnel stage
+const maxKeyFields = 4
+
+// noStage marks missing predecessor or successor of funnel stage
+const noStage = -1
+
+// messageKey identifies one message passing through the funnel by values of
+// key fields. The last key field (for example Kafka offset) is the most
+// selective one and it is used to index messages. Other fields missing in
+// older logs (for example topic or partition) match any value.
+type messageKey [maxKeyFields]string
+
+// matches method checks whether two keys identify the same message
+func (key messageKey) matches(other messageKey) bool {
+	if key[maxKeyFields-1] != other[maxKeyFields-1] {
+		return false
+	}
+	for i := 0; i < maxKeyFields-1; i++ {
+		if key[i] != "" && other[i] != "" && key[i] != other[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// primary method returns value of the most selective key field
+func (key messageKey) primary() string {
+	return key[maxKeyFields-1]
+}
+
+// logFields contains all fields of one log entry, so funnel stages can
+// match any of them
+type logFields map[string]interface{}
+
+// parseLogFields function parses all fields of one log entry. Numbers are
+// kept in their textual form.
+func parseLogFields(text string) (logFields, error) {
+	fields := logFields{}
+	decoder := json.NewDecoder(bytes.NewReader([]byte(text)))
+	decoder.UseNumber()
+	err := decoder.Decode(&fields)
+	return fields, err
+}
+
+// value method returns value of given field as string. Missing fields and
+// null values are returned as empty string.
+func (fields logFields) value(name string) string {
+	switch value := fields[name].(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// matchRule selects log entries by value of one field
+type matchRule struct {
+	field string
+	match func(value string) bool
+}
+
+// funnelStage represents one compiled stage of funnel
+type funnelStage struct {
+	name      string
+	after     int
+	next      int
+	keys      []string
+	rules     []matchRule
+	optional  bool
+	correlate bool
+}
+
+// funnel contains all stages of funnel in the order they are declared in
+// configuration. Required stages form a chain that starts by the first
+// stage; each message is supposed to pass through all of them.
+type funnel struct {
+	stages []funnelStage
+	first  int
+	last   int
+}
+
+// FunnelTransition describes messages that reached stage From, but not the
+// following stage To. It is used to generate drill-down menus.
+type FunnelTransition struct {
+	From string
+	To   string
+}
+
+// newMatchRule function compiles one match rule
+func newMatchRule(rule config.MatchRule) (matchRule, error) {
+	expected := rule.Value
+	switch rule.Type {
+	case config.MatchExact, "":
+		return matchRule{rule.Field, func(value string) bool {
+			return value == expected
+		}}, nil
+	case config.MatchPrefix:
+		return matchRule{rule.Field, func(value string) bool {
+			return strings.HasPrefix(value, expected)
+		}}, nil
+	case config.MatchRegex:
+		compiled, err := regexp.Compile(expected)
+		if err != nil {
+			return matchRule{}, err
+		}
+		return matchRule{rule.Field, compiled.MatchString}, nil
+	}
+	return matchRule{}, fmt.Errorf("unknown match type '%s', use %s, %s, or %s", rule.Type, config.MatchExact, config.MatchPrefix, config.MatchRegex)
+}
+
+// newFunnel function compiles funnel from its configuration and checks
+// that required stages form a single chain
+func newFunnel(configured []config.FunnelStageConfig) (*funnel, error) {
+	if len(configured) == 0 {
+		return nil, fmt.Errorf("no stage defined")
+	}
+
+	f := funnel{first: noStage}
+	byName := make(map[string]int)
+	for i, stage := range configured {
+		if stage.Name == "" {
+			return nil, fmt.Errorf("stage #%d has no name", i+1)
+		}
+		if _, found := byName[stage.Name]; found {
+			return nil, fmt.Errorf("stage '%s' defined twice", stage.Name)
+		}
+		if len(stage.Match) == 0 {
+			return nil, fmt.Errorf("stage '%s' has no match rule", stage.Name)
+		}
+		if len(stage.Keys) > maxKeyFields {
+			return nil, fmt.Errorf("stage '%s' has more than %d key fields", stage.Name, maxKeyFields)
+		}
+		byName[stage.Name] = i
+
+		compiled := funnelStage{
+			name:      stage.Name,
+			after:     noStage,
+			next:      noStage,
+			keys:      stage.Keys,
+			optional:  stage.Optional,
+			correlate: stage.Correlate,
+		}
+		for _, rule := range stage.Match {
+			rule, err := newMatchRule(rule)
+			if err != nil {
+				return nil, fmt.Errorf("stage '%s': %v", stage.Name, err)
+			}
+			compiled.rules = append(compiled.rules, rule)
+		}
+		f.stages = append(f.stages, compiled)
+	}
+
+	for i, stage := range configured {
+		current := &f.stages[i]
+		if stage.After == "" {
+			if stage.Optional {
+				continue
+			}
+			if f.first != noStage {
+				return nil, fmt.Errorf("stages '%s' and '%s' have no predecessor", f.stages[f.first].name, stage.Name)
+			}
+			f.first = i
+			continue
+		}
+		after, found := byName[stage.After]
+		if !found {
+			return nil, fmt.Errorf("stage '%s' follows unknown stage '%s'", stage.Name, stage.After)
+		}
+		current.after = after
+		if stage.Optional {
+			continue
+		}
+		if f.stages[after].optional {
+			return nil, fmt.Errorf("required stage '%s' follows optional stage '%s'", stage.Name, stage.After)
+		}
+		if f.stages[after].next != noStage {
+			return nil, fmt.Errorf("stages '%s' and '%s' both follow '%s'", f.stages[f.stages[after].next].name, stage.Name, stage.After)
+		}
+		f.stages[after].next = i
+	}
+	if f.first == noStage {
+		return nil, fmt.Errorf("no required stage without predecessor")
+	}
+
+	// all required stages need to be reachable from the first one, the
+	// first stage has no predecessor, so the chain can't contain cycle
+	required := 0
+	for i := range f.stages {
+		if !f.stages[i].optional {
+			required++
+		}
+	}
+	chain := f.chain()
+	if len(chain) != required {
+		return nil, fmt.Errorf("%d required stages are not reachable from stage '%s'", required-len(chain), f.stages[f.first].name)
+	}
+	f.last = chain[len(chain)-1]
+	return &f, nil
+}
+
+// checkKeys method checks that messages can be followed through all
+// transitions of the funnel. Both stages of each transition need at least one
+// key field, otherwise all their entries would share the same empty key and
+// no message or all messages would be stuck. CCX data pipeline doesn't need
+// key fields, as its entries are linked into traces by order.
+func (f *funnel) checkKeys() error {
+	for _, transition := range f.transitions() {
+		for _, stage := range transition {
+			if len(f.stages[stage].keys) == 0 {
+				return fmt.Errorf("stage '%s' has no key field, but it is used in transition '%s'", f.stages[stage].name, f.describe(transition))
+			}
+		}
+	}
+	return nil
+}
+
+// chain method returns required stages in the order messages pass through
+// them
+func (f *funnel) chain() []int {
+	chain := []int{}
+	for stage := f.first; stage != noStage; stage = f.stages[stage].next {
+		chain = append(chain, stage)
+	}
+	return chain
+}
+
+// transitions method returns all pairs of stages that can be used to find
+// stuck messages: each stage with its predecessor
+func (f *funnel) transitions() [][2]int {
+	transitions := [][2]int{}
+	for i := range f.stages {
+		if f.stages[i].after != noStage {
+			transitions = append(transitions, [2]int{f.stages[i].after, i})
+		}
+	}
+	return transitions
+}
+
+// describeTransitions method returns names of stages of all transitions
+func (f *funnel) describeTransitions() []FunnelTransition {
+	described := []FunnelTransition{}
+	for _, transition := range f.transitions() {
+		described = append(described, FunnelTransition{
+			From: f.stages[transition[0]].name,
+			To:   f.stages[transition[1]].name,
+		})
+	}
+	return described
+}
+
+// describe method returns title of given transition
+func (f *funnel) describe(transition [2]int) string {
+	return FunnelTransition{f.stages[transition[0]].name, f.stages[transition[1]].name}.String()
+}
+
+// String method returns title of the transition, for example "Consumed but
+// not read"
+func (transition FunnelTransition) String() string {
+	return transition.From + " but not " + strings.ToLower(transition.To)
+}
+
+// classify method returns the first stage whose rules are all satisfied by
+// the log entry. False is returned for entries that don't belong to any
+// stage.
+func (f *funnel) classify(fields logFields) (int, bool) {
+	for i := range f.stages {
+		if f.stages[i].matches(fields) {
+			return i, true
+		}
+	}
+	return noStage, false
+}
+
+// matches method checks whether the log entry satisfies all rules
+func (stage *funnelStage) matches(fields logFields) bool {
+	for _, rule := range stage.rules {
+		if !rule.match(fields.value(rule.field)) {
+			return false
+		}
+	}
+	return true
+}
+
+// key method returns key of the message the log entry belongs to. Key
+// fields are aligned to the end of the key, so the last field is always the
+// most selective one.
+func (f *funnel) key(stage int, fields logFields) messageKey {
+	var key messageKey
+	keys := f.stages[stage].keys
+	offset := maxKeyFields - len(keys)
+	for i, field := range keys {
+		key[offset+i] = fields.value(field)
+	}
+	return key
+}
+
+// formatKey method returns key in human readable form, with names of key
+// fields of the first stage
+func (f *funnel) formatKey(key messageKey) string {
+	keys := f.stages[f.first].keys
+	offset := maxKeyFields - len(keys)
+	parts := []string{}
+	for i, field := range keys {
+		if key[offset+i] != "" {
+			parts = append(parts, field+" "+key[offset+i])
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// keyFields method returns names of key fields of all stages
+func (f *funnel) keyFields() []string {
+	fields := []string{}
+	seen := make(map[string]bool)
+	for i := range f.stages {
+		for _, field := range f.stages[i].keys {
+			if !seen[field] {
+				seen[field] = true
+				fields = append(fields, field)
+			}
+		}
+	}
+	return fields
+}
+
+// correlated method returns stage marked for correlation of reports, or
+// noStage when no stage is marked
+func (f *funnel) correlated() int {
+	for i := range f.stages {
+		if f.stages[i].correlate {
+			return i
+		}
+	}
+	return noStage
+}
+
+// nameWidth method returns length of the longest stage name
+func (f *funnel) nameWidth() int {
+	width := 0
+	for i := range f.stages {
+		if len(f.stages[i].name) > width {
+			width = len(f.stages[i].name)
+		}
+	}
+	return width
+}
+
+// Funnels of analysed services, default ones are used until configuration
+// is read
+var (
+	aggregatorFunnel = mustDefaultFunnel(config.AggregatorService)
+	pipelineFunnel   = mustDefaultFunnel(config.PipelineService)
+)
+
+// mustDefaultFunnel function compiles default funnel of given service
+func mustDefaultFunnel(service string) *funnel {
+	configured, err := config.ReadFunnelConfig(service)
+	if err != nil {
+		panic(err)
+	}
+	f, err := newFunnel(configured)
+	if err != nil {
+		panic(fmt.Errorf("default funnel of service '%s': %v", service, err))
+	}
+	return f
+}
+
+// readFunnel function reads and compiles funnel of given service
+func readFunnel(service string) (*funnel, error) {
+	configured, err := config.ReadFunnelConfig(service)
+	if err != nil {
+		return nil, err
+	}
+	f, err := newFunnel(configured)
+	if err != nil {
+		return nil, fmt.Errorf("funnel of service '%s': %v", service, err)
+	}
+	return f, nil
+}
+
+// ReadFunnels function reads funnels of aggregator and CCX data pipeline
+// from configuration. Logs loaded later are analysed using these funnels.
+func ReadFunnels() error {
+	aggregator, err := readFunnel(config.AggregatorService)
+	if err != nil {
+		return err
+	}
+	err = aggregator.checkKeys()
+	if err != nil {
+		return fmt.Errorf("funnel of service '%s': %v", config.AggregatorService, err)
+	}
+	pipeline, err := readFunnel(config.PipelineService)
+	if err != nil {
+		return err
+	}
+	aggregatorFunnel = aggregator
+	pipelineFunnel = pipeline
+	return nil
+}
+
+// AggregatorFunnelTransitions function returns all transitions between
+// stages of aggregator funnel that can be used to find stuck messages
+func AggregatorFunnelTransitions() []FunnelTransition {
+	return aggregatorFunnel.describeTransitions()
+}
+
+// PipelineFunnelTransitions function returns all transitions between
+// stages of CCX data pipeline funnel that can be used to find stuck
+// messages
+func PipelineFunnelTransitions() []FunnelTransition {
+	return pipelineFunnel.describeTransitions()
+}
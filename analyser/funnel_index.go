@@ -0,0 +1,263 @@
+// Copyright 2020, 2021, 2022 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package analyser
+
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/ccx-data-pipeline-monitor/packages/analyser/funnel_index.html
+
+import (
+	"github.com/logrusorgru/aurora"
+)
+
+// stageItem represents one message that reached given stage. Just the
+// message key, owner of the report, source pod, and location of log entry in
+// log file are stored; the entry itself is read from the file when needed.
+type stageItem struct {
+	key          messageKey
+	location     int64
+	time         int64
+	organization int
+	cluster      string
+	pod          string
+}
+
+// stageSet contains all messages that reached given stage in the order they
+// have been logged. Messages are indexed by the most selective key field
+// (offset by default), so lookup by key needs to check just messages with
+// the same offset from other topics or partitions.
+type stageSet struct {
+	items []stageItem
+	byKey map[string][]int
+}
+
+func (set *stageSet) add(item stageItem) {
+	primary := item.key.primary()
+	set.byKey[primary] = append(set.byKey[primary], len(set.items))
+	set.items = append(set.items, item)
+}
+
+// find method returns item with given key or nil if such item does not exist
+func (set *stageSet) find(key messageKey) *stageItem {
+	for _, i := range set.byKey[key.primary()] {
+		if set.items[i].key.matches(key) {
+			return &set.items[i]
+		}
+	}
+	return nil
+}
+
+func (set *stageSet) contains(key messageKey) bool {
+	return set.find(key) != nil
+}
+
+// funnelIndex contains messages split into stages of one funnel and error
+// entries indexed by message key. It is shared by the aggregator index and
+// by indexes of services analysed by generic analyser, so stuck messages,
+// errors, and funnel statistic are computed the same way for all of them.
+// Index of service without funnel contains just error entries.
+type funnelIndex struct {
+	funnel *funnel
+	stages []stageSet
+	errors map[string][]stageItem
+	names  map[string]string
+
+	// pod and time of the last entry, and the last message processed by
+	// each pod, used to describe context of crashes
+	lastPod    string
+	lastTime   int64
+	processing map[string]stageItem
+}
+
+// newFunnelIndex function constructs empty index for given funnel, that
+// might be nil
+func newFunnelIndex(f *funnel) funnelIndex {
+	index := funnelIndex{
+		funnel: f,
+		errors: make(map[string][]stageItem),
+		names:  make(map[string]string),
+
+		processing: make(map[string]stageItem),
+	}
+	if f != nil {
+		index.stages = make([]stageSet, len(f.stages))
+		for stage := range index.stages {
+			index.stages[stage].byKey = make(map[string][]int)
+		}
+	}
+	return index
+}
+
+// intern method returns shared copy of given name. Topic, cluster, and pod
+// names are interned, so all items share the same few strings.
+func (index *funnelIndex) intern(name string) string {
+	interned, found := index.names[name]
+	if !found {
+		index.names[name] = name
+		return name
+	}
+	return interned
+}
+
+// key method returns key of message the entry belongs to. Key fields of
+// given stage are used, key fields of the first stage are used for entries
+// outside the funnel. All fields, except the most selective one, are
+// interned.
+func (index *funnelIndex) key(stage int, fields logFields) messageKey {
+	if stage == noStage {
+		stage = index.funnel.first
+	}
+	key := index.funnel.key(stage, fields)
+	for i := 0; i < maxKeyFields-1; i++ {
+		key[i] = index.intern(key[i])
+	}
+	return key
+}
+
+// addItem method adds item of message that reached given stage into the
+// index. The message is processed by the pod that logged the item.
+func (index *funnelIndex) addItem(stage int, item stageItem) {
+	index.stages[stage].add(item)
+	index.processing[item.pod] = item
+}
+
+// addError method adds error entry into the index
+func (index *funnelIndex) addError(item stageItem) {
+	primary := item.key.primary()
+	index.errors[primary] = append(index.errors[primary], item)
+}
+
+// find method returns item for message with given key that reached given
+// stage, or nil if the message has not reached the stage
+func (index *funnelIndex) find(stage int, key messageKey) *stageItem {
+	return index.stages[stage].find(key)
+}
+
+// ownerItem method returns the first item of message with given key that
+// contains owner of the report. Item with cluster is preferred, item with
+// just organization is returned when the cluster is not known. Nil is
+// returned when the owner is not known.
+func (index *funnelIndex) ownerItem(key messageKey) *stageItem {
+	if key.primary() == "" {
+		return nil
+	}
+	var organization *stageItem
+	for stage := range index.stages {
+		item := index.stages[stage].find(key)
+		switch {
+		case item == nil:
+			continue
+		case item.cluster != "":
+			return item
+		case item.organization != 0 && organization == nil:
+			organization = item
+		}
+	}
+	return organization
+}
+
+// enteredAt method returns time when the message entered the funnel. Time
+// of the item itself is used when the record from the first stage is not
+// available.
+func (index *funnelIndex) enteredAt(item stageItem) int64 {
+	if item.key.primary() == "" {
+		return item.time
+	}
+	entered := index.stages[index.funnel.first].find(item.key)
+	if entered == nil {
+		return item.time
+	}
+	return entered.time
+}
+
+// count method returns number of messages that reached given stage and
+// that entered the funnel within given time window. Messages are counted by
+// the time they entered the funnel, so messages that entered it just before
+// the window don't make the later stages larger than the previous ones.
+func (index *funnelIndex) count(stage int, window TimeWindow) int {
+	if window.IsUnlimited() {
+		return len(index.stages[stage].items)
+	}
+
+	count := 0
+	for _, item := range index.stages[stage].items {
+		if window.containsNano(index.enteredAt(item)) {
+			count++
+		}
+	}
+	return count
+}
+
+// stuckAfter method returns all messages that reached stage within given
+// time window, but that did not reach the next stage. The next stage might
+// be reached after the window ends.
+func (index *funnelIndex) stuckAfter(stage, nextStage int, window TimeWindow) []stageItem {
+	stuck := []stageItem{}
+	next := &index.stages[nextStage]
+
+	for _, item := range index.stages[stage].items {
+		if window.containsNano(item.time) && !next.contains(item.key) {
+			stuck = append(stuck, item)
+		}
+	}
+	return stuck
+}
+
+// errorsFor method returns all error entries related to message with given
+// key. Errors without key are not related to any message.
+func (index *funnelIndex) errorsFor(key messageKey) []stageItem {
+	errors := []stageItem{}
+	if key.primary() == "" {
+		return errors
+	}
+	for _, item := range index.errors[key.primary()] {
+		if item.key.matches(key) {
+			errors = append(errors, item)
+		}
+	}
+	return errors
+}
+
+// errorStage method returns funnel stage where the error happened, that is
+// the stage after the last required one reached by the message
+func (index *funnelIndex) errorStage(key messageKey) string {
+	if index.funnel == nil || key.primary() == "" {
+		return outsideFunnel
+	}
+	chain := index.funnel.chain()
+	for i := len(chain) - 1; i >= 0; i-- {
+		if index.stages[chain[i]].contains(key) {
+			return "after " + index.funnel.stages[chain[i]].name
+		}
+	}
+	return outsideFunnel
+}
+
+// printFunnelStatistic function prints number of messages that reached
+// each funnel stage. Messages excluded are those that reached the
+// predecessor of the stage, but not the stage itself.
+func printFunnelStatistic(colorizer aurora.Aurora, index *funnelIndex, width int, window TimeWindow) {
+	counts := make([]int, len(index.stages))
+	for stage := range index.stages {
+		counts[stage] = index.count(stage, window)
+	}
+
+	for stage, count := range counts {
+		previous := count
+		if after := index.funnel.stages[stage].after; after != noStage {
+			previous = counts[after]
+		}
+		printStatisticLine(colorizer, width, index.funnel.stages[stage].name, count, previous)
+	}
+}
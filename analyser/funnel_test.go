@@ -0,0 +1,90 @@
+// Copyright 2020, 2021, 2022 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package analyser
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/RedHatInsights/ccx-data-pipeline-monitor/config"
+)
+
+// messageStage function constructs stage matched by message
+func messageStage(name, after string, keys ...string) config.FunnelStageConfig {
+	return config.FunnelStageConfig{
+		Name:  name,
+		After: after,
+		Keys:  keys,
+		Match: []config.MatchRule{{Field: "message", Value: name}},
+	}
+}
+
+func TestFunnelCheckKeys(t *testing.T) {
+	optional := messageStage("Retried", "", "request")
+	optional.Optional = true
+	unkeyedOptional := messageStage("Throttled", "")
+	unkeyedOptional.Optional = true
+
+	tests := []struct {
+		name     string
+		stages   []config.FunnelStageConfig
+		expected string
+	}{
+		{"all stages have keys",
+			[]config.FunnelStageConfig{messageStage("Received", "", "request"), messageStage("Written", "Received", "request")},
+			""},
+		{"single stage without keys",
+			[]config.FunnelStageConfig{messageStage("Received", "")},
+			""},
+		{"optional stage without keys outside transitions",
+			[]config.FunnelStageConfig{messageStage("Received", "", "request"), optional, unkeyedOptional},
+			""},
+		{"predecessor without keys",
+			[]config.FunnelStageConfig{messageStage("Received", ""), messageStage("Written", "Received", "request")},
+			"stage 'Received' has no key field"},
+		{"successor without keys",
+			[]config.FunnelStageConfig{messageStage("Received", "", "request"), messageStage("Written", "Received")},
+			"stage 'Written' has no key field"},
+		{"optional successor without keys",
+			[]config.FunnelStageConfig{messageStage("Received", "", "request"), messageStage("Written", "Received", "request"), {
+				Name: "Notified", After: "Written", Optional: true, Match: []config.MatchRule{{Field: "message", Value: "Notified"}},
+			}},
+			"stage 'Notified' has no key field"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f, err := newFunnel(test.stages)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = f.checkKeys()
+			switch {
+			case test.expected == "" && err != nil:
+				t.Errorf("unexpected error %v", err)
+			case test.expected != "" && (err == nil || !strings.Contains(err.Error(), test.expected)):
+				t.Errorf("expected error '%s', got %v", test.expected, err)
+			}
+		})
+	}
+}
+
+func TestDefaultFunnelKeys(t *testing.T) {
+	// pipeline entries are linked into traces, so just aggregator needs keys
+	err := mustDefaultFunnel(config.AggregatorService).checkKeys()
+	if err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,357 @@
+// Copyright 2020, 2021, 2022 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package analyser
+
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/ccx-data-pipeline-monitor/packages/analyser/incidents.html
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/logrusorgru/aurora"
+)
+
+// Kinds of incidents recognized in plain text blocks
+const (
+	incidentGoPanic         = "Go panic"
+	incidentPythonTraceback = "Python traceback"
+)
+
+// pythonTracebackStart is the first line of Python traceback
+const pythonTracebackStart = "Traceback (most recent call last):"
+
+// incidentTimeFormat is used to display times of incidents of all services
+const incidentTimeFormat = "2006-01-02 15:04:05.000"
+
+// maximum number of occurrences displayed for each incident
+const incidentOccurrences = 5
+
+// Regular expressions used to recognize parts of stack traces
+var (
+	goPanicRegexp         = regexp.MustCompile(`^(?:panic|fatal error): (.*?)(?: \[recovered\])?$`)
+	goGoroutineRegexp     = regexp.MustCompile(`^goroutine \d+ \[`)
+	goFrameFileRegexp     = regexp.MustCompile(`^\s+(\S+:\d+)`)
+	pythonFrameRegexp     = regexp.MustCompile(`^\s+File "([^"]+)", line (\d+), in (.+)$`)
+	pythonExceptionRegexp = regexp.MustCompile(`^([A-Za-z_][\w.]*)(?::\s*(.*))?$`)
+	incidentNumberRegexp  = regexp.MustCompile(`\b(?:0x[0-9a-fA-F]+|\d+)\b`)
+)
+
+// incidentOccurrence represents one crash of service
+type incidentOccurrence struct {
+	crashContext
+	message string
+}
+
+// incident represents group of identical stack traces: the same kind,
+// exception type, and top frame
+type incident struct {
+	kind        string
+	exception   string
+	frame       string
+	occurrences []incidentOccurrence
+}
+
+// stackTrace contains information extracted from one plain text block
+type stackTrace struct {
+	kind      string
+	exception string
+	message   string
+	frame     string
+}
+
+// goFunctionName function strips arguments from function name printed in
+// Go stack trace
+func goFunctionName(line string) string {
+	line = strings.TrimSpace(line)
+	i := strings.LastIndex(line, "(")
+	if i <= 0 {
+		return line
+	}
+	return line[:i]
+}
+
+// isGoRuntimeFrame function checks whether the frame belongs to code that
+// raises panic, not to the code that caused it
+func isGoRuntimeFrame(function string) bool {
+	return strings.HasPrefix(function, "runtime.") || strings.HasPrefix(function, "panic")
+}
+
+// parseGoPanic function extracts panic message and top frame of panicking
+// goroutine from Go stack trace
+func parseGoPanic(lines []string) (stackTrace, bool) {
+	trace := stackTrace{kind: incidentGoPanic}
+	found := false
+	for i, line := range lines {
+		if !found {
+			match := goPanicRegexp.FindStringSubmatch(line)
+			if match != nil {
+				found = true
+				trace.message = match[1]
+				trace.exception = incidentNumberRegexp.ReplaceAllString(match[1], "N")
+			}
+			continue
+		}
+		if !goGoroutineRegexp.MatchString(line) {
+			continue
+		}
+		// function names and file names follow on separate lines
+		for j := i + 1; j+1 < len(lines); j += 2 {
+			function := goFunctionName(lines[j])
+			if isGoRuntimeFrame(function) {
+				continue
+			}
+			trace.frame = function
+			match := goFrameFileRegexp.FindStringSubmatch(lines[j+1])
+			if match != nil {
+				trace.frame += " (" + match[1] + ")"
+			}
+			break
+		}
+		break
+	}
+	return trace, found
+}
+
+// parsePythonTraceback function extracts exception type and the innermost
+// frame from Python traceback
+func parsePythonTraceback(lines []string) (stackTrace, bool) {
+	trace := stackTrace{kind: incidentPythonTraceback}
+	found := false
+	for _, line := range lines {
+		if strings.TrimSpace(line) == pythonTracebackStart {
+			found = true
+			continue
+		}
+		if !found {
+			continue
+		}
+		if match := pythonFrameRegexp.FindStringSubmatch(line); match != nil {
+			trace.frame = match[3] + " (" + match[1] + ":" + match[2] + ")"
+			continue
+		}
+		if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+			continue
+		}
+		// the last line that is not indented describes the exception
+		if match := pythonExceptionRegexp.FindStringSubmatch(line); match != nil {
+			trace.exception = match[1]
+			trace.message = match[2]
+		}
+	}
+	return trace, found && trace.exception != ""
+}
+
+// parseStackTrace function recognizes Go panic or Python traceback in
+// given plain text lines
+func parseStackTrace(lines []string) (stackTrace, bool) {
+	if trace, ok := parseGoPanic(lines); ok {
+		return trace, true
+	}
+	return parsePythonTraceback(lines)
+}
+
+// findIncidents function reads all plain text blocks attached to log
+// entries, recognizes stack traces in them, and groups identical traces
+// together. Incidents are sorted by number of occurrences.
+func findIncidents(reader *logReader, lines *logLines, window TimeWindow) ([]*incident, error) {
+	incidents := []*incident{}
+	byKey := make(map[string]*incident)
+
+	for i := range lines.blocks {
+		block := &lines.blocks[i]
+		if !window.containsNano(block.context.time) {
+			continue
+		}
+		text, err := blockText(reader, block)
+		if err != nil {
+			return nil, err
+		}
+		trace, ok := parseStackTrace(text)
+		if !ok {
+			continue
+		}
+		key := trace.kind + "\n" + trace.exception + "\n" + trace.frame
+		found := byKey[key]
+		if found == nil {
+			found = &incident{
+				kind:      trace.kind,
+				exception: trace.exception,
+				frame:     trace.frame,
+			}
+			byKey[key] = found
+			incidents = append(incidents, found)
+		}
+		found.occurrences = append(found.occurrences, incidentOccurrence{block.context, trace.message})
+	}
+
+	sort.SliceStable(incidents, func(i, j int) bool {
+		return len(incidents[i].occurrences) > len(incidents[j].occurrences)
+	})
+	return incidents, nil
+}
+
+// crashContext method describes the last message processed by the pod that
+// has written the last log entry of aggregator or other service with funnel
+func (index *funnelIndex) crashContext() crashContext {
+	context := crashContext{time: index.lastTime, pod: index.lastPod}
+	item, found := index.processing[index.lastPod]
+	if !found {
+		return context
+	}
+	context.processed = index.funnel.formatKey(item.key)
+	if owner := index.ownerItem(item.key); owner != nil {
+		item = *owner
+	}
+	if item.cluster != "" {
+		context.processed += fmt.Sprintf(" organization %d cluster %s", item.organization, item.cluster)
+	}
+	return context
+}
+
+// crashContext method describes the trace that has been processed by the
+// pod that has written the last CCX data pipeline log entry
+func (index *pipelineIndex) crashContext() crashContext {
+	context := crashContext{time: index.lastTime, pod: index.lastPod}
+	trace := index.current[index.lastPod]
+	if trace == nil {
+		return context
+	}
+	context.processed = "trace " + trace.ID()
+	if trace.ClusterID != "" && trace.ClusterID != trace.ID() {
+		context.processed += " cluster " + trace.ClusterID
+	}
+	return context
+}
+
+// formatIncidentTime function formats time of incident, zero time is
+// displayed as unknown
+func formatIncidentTime(t int64) string {
+	if t == 0 {
+		return "unknown time"
+	}
+	return time.Unix(0, t).UTC().Format(incidentTimeFormat)
+}
+
+func printIncident(colorizer aurora.Aurora, i int, found *incident) {
+	e := strconv.Itoa(i + 1)
+	occurrences := found.occurrences
+	fmt.Printf("%5s  %s  %s  %s occurrences\n", colorizer.Blue(e), colorizer.Cyan(found.kind), colorizer.Red(found.exception), colorizer.Yellow(strconv.Itoa(len(occurrences))))
+	frame := found.frame
+	if frame == "" {
+		frame = "unknown"
+	}
+	fmt.Printf("%5s  %-10s %s\n", "", "top frame", frame)
+	fmt.Printf("%5s  %-10s %s\n", "", "first", colorizer.Gray(8, formatIncidentTime(occurrences[0].time)))
+	fmt.Printf("%5s  %-10s %s\n", "", "last", colorizer.Gray(8, formatIncidentTime(occurrences[len(occurrences)-1].time)))
+
+	// the newest occurrences are the most interesting ones
+	if len(occurrences) > incidentOccurrences {
+		fmt.Printf("\t%s\n", colorizer.Gray(8, fmt.Sprintf("%d older occurrences not displayed", len(occurrences)-incidentOccurrences)))
+		occurrences = occurrences[len(occurrences)-incidentOccurrences:]
+	}
+	for _, occurrence := range occurrences {
+		processed := occurrence.processed
+		if processed == "" {
+			processed = "no message processed"
+		}
+		fmt.Printf("\t%s  ", colorizer.Gray(8, formatIncidentTime(occurrence.time)))
+		if occurrence.pod != "" {
+			fmt.Printf("%s  ", occurrence.pod)
+		}
+		fmt.Print(processed)
+		if occurrence.message != "" && occurrence.message != found.exception {
+			fmt.Printf("  %s", colorizer.Red(occurrence.message))
+		}
+		fmt.Println()
+	}
+}
+
+// printIncidents function prints all incidents found in one log file
+func printIncidents(colorizer aurora.Aurora, title string, reader *logReader, lines *logLines, window TimeWindow) error {
+	incidents, err := findIncidents(reader, lines, window)
+	if err != nil {
+		return err
+	}
+	fmt.Println(colorizer.Blue(title))
+	if len(incidents) == 0 {
+		fmt.Println(colorizer.Green("no panics or tracebacks found"))
+	}
+	for i, found := range incidents {
+		printIncident(colorizer, i, found)
+	}
+	fmt.Println()
+	return nil
+}
+
+func printServiceIncidents(colorizer aurora.Aurora, window TimeWindow) error {
+	if aggregatorStageIndex != nil {
+		reader, err := aggregatorStageIndex.open()
+		if err != nil {
+			return err
+		}
+		defer reader.close()
+		err = printIncidents(colorizer, "Aggregator", reader.logReader, &aggregatorStageIndex.lines, window)
+		if err != nil {
+			return err
+		}
+	}
+	if pipelineStageIndex != nil {
+		reader, err := pipelineStageIndex.open()
+		if err != nil {
+			return err
+		}
+		defer reader.close()
+		err = printIncidents(colorizer, "CCX data pipeline", reader.logReader, &pipelineStageIndex.lines, window)
+		if err != nil {
+			return err
+		}
+	}
+	for _, service := range genericServices {
+		if service.index == nil {
+			continue
+		}
+		reader, err := service.index.open()
+		if err != nil {
+			return err
+		}
+		defer reader.close()
+		err = printIncidents(colorizer, service.config.Name, reader.logReader, &service.index.lines, window)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PrintIncidents function prints Go panics and Python tracebacks found in
+// logs of aggregator, CCX data pipeline, and other services within given
+// time window. Identical stack traces are grouped together and each
+// occurrence is linked to the message processed by the pod before the
+// crash.
+func PrintIncidents(colorizer aurora.Aurora, window TimeWindow) {
+	if aggregatorStageIndex == nil && pipelineStageIndex == nil && !genericServicesLoaded() {
+		fmt.Println(colorizer.Red(logsAreNotLoaded))
+		return
+	}
+	err := printServiceIncidents(colorizer, window)
+	if err != nil {
+		fmt.Println(colorizer.Red(err))
+	}
+}
@@ -0,0 +1,303 @@
+// Copyright 2020, 2021, 2022 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package analyser
+
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/ccx-data-pipeline-monitor/packages/analyser/load.html
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/RedHatInsights/ccx-data-pipeline-monitor/config"
+)
+
+// detectedLines is the number of lines read to detect format of log file
+const detectedLines = 100
+
+// LogFiles contains log files found by FindLogFiles sorted by service that
+// produced them. Logs of services analysed by generic analyser are stored
+// by service name.
+type LogFiles struct {
+	Aggregator []string
+	Pipeline   []string
+	Services   map[string][]string
+	Unknown    []string
+}
+
+// compressedFile represents decompressed content of compressed file
+type compressedFile struct {
+	io.ReadCloser
+	file *os.File
+}
+
+// Close method closes both decompressor and the file
+func (compressed *compressedFile) Close() error {
+	err := compressed.ReadCloser.Close()
+	closeErr := compressed.file.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+// openLogFile function opens log file for reading. Files compressed by gzip
+// (.gz) or Zstandard (.zst) are decompressed transparently.
+func openLogFile(filename string) (io.ReadCloser, error) {
+	// disable "G304 (CWE-22): Potential file inclusion via variable"
+	file, err := os.Open(filename) // #nosec G304
+	if err != nil {
+		return nil, err
+	}
+
+	var reader io.ReadCloser
+	switch filepath.Ext(filename) {
+	case ".gz":
+		reader, err = gzip.NewReader(file)
+	case ".zst", ".zstd":
+		var decoder *zstd.Decoder
+		decoder, err = zstd.NewReader(file)
+		if err == nil {
+			reader = decoder.IOReadCloser()
+		}
+	default:
+		return file, nil
+	}
+	if err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	return &compressedFile{reader, file}, nil
+}
+
+// detectLogEntry function returns service that produced the log entry
+// when the entry belongs to a funnel stage of aggregator or of other
+// registered service. CCX data pipeline entries are recognized by
+// attributes of Python logging. Empty string is returned when the entry
+// does not identify the service.
+func detectLogEntry(fields logFields) string {
+	if _, ok := aggregatorFunnel.classify(fields); ok {
+		return formatAggregator
+	}
+	for _, service := range genericServices {
+		if service.funnel == nil {
+			continue
+		}
+		if _, ok := service.funnel.classify(fields); ok {
+			return service.config.Name
+		}
+	}
+	_, levelname := fields["levelname"]
+	_, asctime := fields["asctime"]
+	if levelname || asctime {
+		return formatPipeline
+	}
+	return ""
+}
+
+// detectLogSchema function returns service whose log entries contain the
+// same attributes as the given entry. Aggregator is recognized by Kafka
+// attributes, other services by attributes of their log schema when just
+// one registered service uses such schema. Aggregator uses zerolog schema
+// too, so other zerolog services need to be recognized by their funnels.
+// Empty string is returned when the entry does not identify the service.
+func detectLogSchema(fields logFields) string {
+	_, level := fields["level"]
+	_, time := fields["time"]
+	_, topic := fields["topic"]
+	_, offset := fields["offset"]
+	if level && topic && offset {
+		return formatAggregator
+	}
+
+	detected := []string{}
+	if level && time {
+		detected = append(detected, formatAggregator)
+	}
+	for _, service := range genericServices {
+		schema := service.config.Schema
+		_, time := fields[schema.Time]
+		_, level := fields[schema.Level]
+		_, message := fields[schema.Message]
+		if time && level && message {
+			detected = append(detected, service.config.Name)
+		}
+	}
+	if len(detected) != 1 || detected[0] == formatAggregator {
+		return ""
+	}
+	return detected[0]
+}
+
+// detectLogFormat function detects whether log file contains logs of
+// aggregator, CCX data pipeline, or other registered service by the first
+// JSON lines. Entries that belong to a funnel stage identify the service,
+// attributes of entries are used when no such entry is found. Empty string
+// is returned for unknown format.
+func detectLogFormat(filename string) (string, error) {
+	file, err := openLogFile(filename)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		err := file.Close()
+		if err != nil {
+			log.Println(err)
+		}
+	}()
+
+	reader := bufio.NewReader(file)
+	bySchema := ""
+	for i := 0; i < detectedLines; i++ {
+		line, err := reader.ReadString('\n')
+		if fields, parseErr := parseLogFields(line); parseErr == nil {
+			if service := detectLogEntry(fields); service != "" {
+				return service, nil
+			}
+			// aggregator attributes are more specific than log schema
+			if service := detectLogSchema(fields); bySchema == "" || service == formatAggregator {
+				bySchema = service
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return bySchema, nil
+}
+
+// Formats of log files recognized by detectLogFormat, other services are
+// recognized by their names
+const (
+	formatAggregator = config.AggregatorService
+	formatPipeline   = config.PipelineService
+)
+
+// expandLogPath function returns all files matching given path, glob
+// pattern or found in given directory and its subdirectories
+func expandLogPath(pattern string) ([]string, error) {
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", pattern, err)
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("%s: no such file or directory", pattern)
+	}
+
+	filenames := []string{}
+	for _, match := range matches {
+		err := filepath.WalkDir(match, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if entry.Type().IsRegular() {
+				filenames = append(filenames, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return filenames, nil
+}
+
+// ExpandLogPaths function returns all log files matching given paths, glob
+// patterns or found in given directories. Each file is returned just once,
+// even when it matches several patterns.
+func ExpandLogPaths(patterns []string) ([]string, error) {
+	files := []string{}
+	found := make(map[string]bool)
+
+	for _, pattern := range patterns {
+		filenames, err := expandLogPath(pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, filename := range filenames {
+			if !found[filename] {
+				found[filename] = true
+				files = append(files, filename)
+			}
+		}
+	}
+	return files, nil
+}
+
+// FindLogFiles function finds all log files matching given paths, glob
+// patterns or directories and sorts them by service that produced them
+func FindLogFiles(patterns []string) (LogFiles, error) {
+	var files LogFiles
+
+	filenames, err := ExpandLogPaths(patterns)
+	if err != nil {
+		return files, err
+	}
+	for _, filename := range filenames {
+		format, err := detectLogFormat(filename)
+		if err != nil {
+			return files, err
+		}
+		switch {
+		case format == formatAggregator:
+			files.Aggregator = append(files.Aggregator, filename)
+		case format == formatPipeline:
+			files.Pipeline = append(files.Pipeline, filename)
+		case IsGenericService(format):
+			if files.Services == nil {
+				files.Services = make(map[string][]string)
+			}
+			files.Services[format] = append(files.Services[format], filename)
+		default:
+			files.Unknown = append(files.Unknown, filename)
+		}
+	}
+	return files, nil
+}
+
+// loadLogFiles function merges given log files into one file ordered by
+// time. Lines repeated in overlapping files of one log (for example in
+// rotated logs) are written just once and each entry is tagged by its
+// source file.
+// Number of skipped duplicate lines is returned.
+func loadLogFiles(filenames []string, output string, format logFormat) (int, error) {
+	sources := make([]LogSource, len(filenames))
+	for i, filename := range filenames {
+		sources[i] = LogSource{
+			Filename: filename,
+			File:     filename,
+		}
+	}
+
+	// output file can be one of sources, so it is replaced at the end
+	temporary := output + ".load"
+	duplicates, err := mergeLogFiles(sources, temporary, format, true)
+	if err != nil {
+		_ = os.Remove(temporary)
+		return 0, err
+	}
+	return duplicates, os.Rename(temporary, output)
+}
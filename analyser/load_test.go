@@ -0,0 +1,278 @@
+// Copyright 2020, 2021, 2022 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package analyser
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/RedHatInsights/ccx-data-pipeline-monitor/config"
+)
+
+// registerTestServices function registers generic services used by the
+// test and restores the original ones when the test ends
+func registerTestServices(t *testing.T, services ...*genericService) {
+	original := genericServices
+	genericServices = services
+	t.Cleanup(func() {
+		genericServices = original
+	})
+}
+
+// writeLines function writes given lines into file in temporary directory
+func writeLines(t *testing.T, name string, lines ...string) string {
+	filename := filepath.Join(t.TempDir(), name)
+	err := os.WriteFile(filename, []byte(strings.Join(lines, "\n")+"\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func TestDetectLogFormat(t *testing.T) {
+	f, err := newFunnel(writerFunnel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notification := config.LogSchema{Time: "ts", TimeFormat: time.RFC3339, Level: "severity", Message: "msg"}
+	registerTestServices(t,
+		&genericService{config: config.ServiceConfig{Name: "writer", Schema: writerSchema}, funnel: f},
+		&genericService{config: config.ServiceConfig{Name: "notification", Schema: notification}},
+	)
+
+	started := `{"level":"info","time":"2022-03-01T10:00:00Z","message":"Started"}`
+	tests := []struct {
+		name     string
+		lines    []string
+		expected string
+	}{
+		{"aggregator funnel entry",
+			[]string{started, `{"level":"info","time":"2022-03-01T10:00:01Z","message":"Consumed","topic":"ccx.ocp.results","offset":1,"partition":0,"group":"aggregator"}`},
+			formatAggregator},
+		{"aggregator Kafka attributes",
+			[]string{started, `{"level":"error","time":"2022-03-01T10:00:01Z","message":"Commit failed","topic":"ccx.ocp.results","offset":1}`},
+			formatAggregator},
+		{"pipeline",
+			[]string{`{"levelname":"INFO","asctime":"2022-03-01 10:00:00,000","message":"JSON schema validated"}`},
+			formatPipeline},
+		{"generic service funnel entry",
+			[]string{started, `{"level":"info","time":"2022-03-01T10:00:01Z","message":"Request received","request":1}`},
+			"writer"},
+		{"generic service schema",
+			[]string{`{"severity":"info","ts":"2022-03-01T10:00:00Z","msg":"Started"}`},
+			"notification"},
+		{"zerolog entries without funnel entry",
+			[]string{started},
+			""},
+		{"plain text",
+			[]string{"Starting service", "Listening on port 8080"},
+			""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			format, err := detectLogFormat(writeLines(t, "test.log", test.lines...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if format != test.expected {
+				t.Errorf("expected format '%s', got '%s'", test.expected, format)
+			}
+		})
+	}
+}
+
+func TestDetectLogFormatAmbiguousSchema(t *testing.T) {
+	// services with the same schema and without funnel can't be recognized
+	schema := config.LogSchema{Time: "ts", TimeFormat: time.RFC3339, Level: "severity", Message: "msg"}
+	registerTestServices(t,
+		&genericService{config: config.ServiceConfig{Name: "writer", Schema: schema}},
+		&genericService{config: config.ServiceConfig{Name: "reader", Schema: schema}},
+	)
+	format, err := detectLogFormat(writeLines(t, "test.log", `{"severity":"info","ts":"2022-03-01T10:00:00Z","msg":"Started"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != "" {
+		t.Errorf("expected unknown format, got '%s'", format)
+	}
+}
+
+func TestFindLogFiles(t *testing.T) {
+	f, err := newFunnel(writerFunnel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registerTestServices(t, &genericService{config: config.ServiceConfig{Name: "writer", Schema: writerSchema}, funnel: f})
+
+	writer := writeLines(t, "writer.log", `{"level":"info","time":"2022-03-01T10:00:01Z","message":"Request received","request":1}`)
+	unknown := writeLines(t, "unknown.log", "Starting service")
+	files, err := FindLogFiles([]string{writer, unknown})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files.Aggregator) != 0 || len(files.Pipeline) != 0 {
+		t.Errorf("unexpected aggregator or pipeline logs %v %v", files.Aggregator, files.Pipeline)
+	}
+	if len(files.Services["writer"]) != 1 || files.Services["writer"][0] != writer {
+		t.Errorf("writer logs not found: %v", files.Services)
+	}
+	if len(files.Unknown) != 1 || files.Unknown[0] != unknown {
+		t.Errorf("unknown logs not found: %v", files.Unknown)
+	}
+}
+
+// compressLines function writes given lines compressed by given compressor
+// into file in temporary directory
+func compressLines(t *testing.T, name string, compressor func(io.Writer) (io.WriteCloser, error), lines ...string) string {
+	var content bytes.Buffer
+	writer, err := compressor(&content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = writer.Write([]byte(strings.Join(lines, "\n") + "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filename := filepath.Join(t.TempDir(), name)
+	err = os.WriteFile(filename, content.Bytes(), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func TestMergeCompressedLogFile(t *testing.T) {
+	gzipCompressor := func(w io.Writer) (io.WriteCloser, error) {
+		return gzip.NewWriter(w), nil
+	}
+	zstdCompressor := func(w io.Writer) (io.WriteCloser, error) {
+		return zstd.NewWriter(w)
+	}
+	lines := []string{
+		pipelineLine("pipeline-1", 0, "JSON schema validated"),
+		pipelineLine("pipeline-1", 0, "Downloading https://s3.example.com/archive-1"),
+	}
+
+	tests := []struct {
+		name     string
+		filename string
+	}{
+		{"plain", writeLines(t, "pipeline.log", lines...)},
+		{"gzip", compressLines(t, "pipeline.log.gz", gzipCompressor, lines...)},
+		{"Zstandard", compressLines(t, "pipeline.log.zst", zstdCompressor, lines...)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			format, err := detectLogFormat(test.filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if format != formatPipeline {
+				t.Errorf("expected pipeline log, got '%s'", format)
+			}
+			merged := filepath.Join(t.TempDir(), "merged.log")
+			err = MergePipelineLogFiles([]LogSource{{Pod: "pipeline-1", Filename: test.filename}}, merged)
+			if err != nil {
+				t.Fatal(err)
+			}
+			index, err := readPipelineLogFile(merged)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if index.entries != len(lines) {
+				t.Errorf("expected %d entries, got %d", len(lines), index.entries)
+			}
+		})
+	}
+}
+
+func TestMergeDamagedZstdLogFile(t *testing.T) {
+	filename := writeLines(t, "pipeline.log.zst", "not compressed")
+	err := MergePipelineLogFiles([]LogSource{{Pod: "pipeline-1", Filename: filename}}, filepath.Join(t.TempDir(), "merged.log"))
+	if err == nil {
+		t.Error("damaged file has been read")
+	}
+}
+
+func TestLogChain(t *testing.T) {
+	tests := []struct {
+		source   LogSource
+		expected string
+	}{
+		{LogSource{Filename: "/logs/pipeline-1.log"}, "pipeline-1.log"},
+		{LogSource{Filename: "/logs/pipeline-1.log.1"}, "pipeline-1.log"},
+		{LogSource{Filename: "/logs/pipeline-1.log.2.gz"}, "pipeline-1.log"},
+		{LogSource{Filename: "/logs/pipeline-1.log-20220301.zst"}, "pipeline-1.log"},
+		{LogSource{Filename: "/logs/pipeline-1.json.gz"}, "pipeline-1.json"},
+		{LogSource{Filename: "/logs/pipeline-2.log"}, "pipeline-2.log"},
+		{LogSource{Filename: "/logs/aggregator-0"}, "aggregator-0"},
+		{LogSource{Pod: "pipeline-1", Filename: "/tmp/pipeline-1.log"}, "pipeline-1"},
+	}
+	for _, test := range tests {
+		if chain := logChain(test.source); chain != test.expected {
+			t.Errorf("%s: expected log %s, got %s", test.source.Filename, test.expected, chain)
+		}
+	}
+}
+
+func TestLoadLogFilesDuplicates(t *testing.T) {
+	sent := pipelineLine("", 1, "Message has been sent successfully")
+	rotated := writeLines(t, "pipeline-1.log.1",
+		pipelineLine("", 0, "JSON schema validated"),
+		sent,
+	)
+	current := writeLines(t, "pipeline-1.log",
+		sent,
+		pipelineLine("", 2, "JSON schema validated"),
+	)
+	// another pod has sent its message at the same time
+	other := writeLines(t, "pipeline-2.log",
+		sent,
+	)
+
+	output := filepath.Join(t.TempDir(), "pipeline.log")
+	duplicates, err := loadLogFiles([]string{rotated, current, other}, output, pipelineLogFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if duplicates != 1 {
+		t.Errorf("expected 1 duplicate line, got %d", duplicates)
+	}
+
+	content, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count := strings.Count(string(content), "Message has been sent successfully"); count != 2 {
+		t.Errorf("expected sent message of both pods, got %d messages", count)
+	}
+	if count := strings.Count(string(content), "\n"); count != 4 {
+		t.Errorf("expected 4 lines, got %d", count)
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2020, 2021, 2022 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package analyser
+
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/ccx-data-pipeline-monitor/packages/analyser/log_file.html
+
+import (
+	"bufio"
+	"io"
+	"log"
+	"math"
+	"os"
+	"strings"
+)
+
+// scanLogFile function reads the given log file line by line and calls the
+// callback function for each line together with its location (byte offset)
+// in the file. Lines are not kept in memory, so the file can be larger than
+// available RAM.
+func scanLogFile(filename string, callback func(line string, location int64)) error {
+	// disable "G304 (CWE-22): Potential file inclusion via variable"
+	file, err := os.Open(filename) // #nosec G304
+	if err != nil {
+		return err
+	}
+
+	_, err = scanLogStream(file, 0, callback)
+
+	// log file needs to be closed properly
+	// try to close the file
+	closeErr := file.Close()
+
+	// in case of error all we can do is to just log the error
+	if closeErr != nil {
+		log.Println(closeErr)
+	}
+
+	return err
+}
+
+// scanLogStream function reads log lines from any reader. The location of
+// the first line is given by the start parameter. Location just after the
+// last line is returned.
+func scanLogStream(input io.Reader, start int64, callback func(line string, location int64)) (int64, error) {
+	reader := bufio.NewReader(input)
+	location := start
+
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			callback(strings.TrimRight(line, "\r\n"), location)
+			location += int64(len(line))
+		}
+		if err == io.EOF {
+			return location, nil
+		}
+		if err != nil {
+			return location, err
+		}
+	}
+}
+
+// logReader provides random access to lines stored in log file. Lines are
+// addressed by their locations collected by scanLogFile.
+type logReader struct {
+	file *os.File
+}
+
+func openLogReader(filename string) (*logReader, error) {
+	// disable "G304 (CWE-22): Potential file inclusion via variable"
+	file, err := os.Open(filename) // #nosec G304
+	if err != nil {
+		return nil, err
+	}
+	return &logReader{file}, nil
+}
+
+// line method reads one line starting at given location
+func (reader *logReader) line(location int64) (string, error) {
+	section := io.NewSectionReader(reader.file, location, math.MaxInt64-location)
+	line, err := bufio.NewReader(section).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// lines method reads given number of lines starting at given location
+func (reader *logReader) lines(location int64, count int) ([]string, error) {
+	section := io.NewSectionReader(reader.file, location, math.MaxInt64-location)
+	buffered := bufio.NewReader(section)
+	lines := make([]string, 0, count)
+	for len(lines) < count {
+		line, err := buffered.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if line == "" && err == io.EOF {
+			break
+		}
+		lines = append(lines, strings.TrimRight(line, "\r\n"))
+	}
+	return lines, nil
+}
+
+func (reader *logReader) close() {
+	err := reader.file.Close()
+	if err != nil {
+		log.Println(err)
+	}
+}
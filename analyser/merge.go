@@ -0,0 +1,418 @@
+// Copyright 2020, 2021, 2022 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package analyser
+
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/ccx-data-pipeline-monitor/packages/analyser/merge.html
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/logrusorgru/aurora"
+)
+
+// containerRestarted is the message of marker entry inserted into merged
+// logs after logs of previous container instance
+const containerRestarted = "Container restarted"
+
+// LogSource represents log file retrieved from one pod or loaded from
+// disk. Previous is set for logs of previous container instance, i.e. logs
+// produced before restart. File is name of the original log file that is
+// recorded in merged entries; it is empty for logs retrieved from pods.
+type LogSource struct {
+	Pod      string
+	Filename string
+	Previous bool
+	File     string
+}
+
+// sourceReader reads lines from one log source during merge. Time of the
+// current line is remembered, lines without timestamp get the time of the
+// previous line, so they stay together with it.
+type sourceReader struct {
+	LogSource
+	chain  string
+	file   io.ReadCloser
+	reader *bufio.Reader
+	line   string
+	time   time.Time
+	marker bool
+	done   bool
+}
+
+// logFormat contains functions that depend on format of merged logs
+type logFormat struct {
+	// timeOf returns time of log line, or zero time when it is not known
+	timeOf func(line string) time.Time
+
+	// restartMarker returns log line marking container restart
+	restartMarker func(pod string, t time.Time) string
+}
+
+// printEntrySource function finishes line with entry by name of pod and
+// name of log file the entry has been read from. Entries without known
+// source (for example from log files stored by older versions) just end the
+// line.
+func printEntrySource(colorizer aurora.Aurora, pod, file string) {
+	source := []string{}
+	for _, name := range []string{pod, file} {
+		if name != "" {
+			source = append(source, name)
+		}
+	}
+	if len(source) == 0 {
+		fmt.Println()
+		return
+	}
+	fmt.Println(" ", colorizer.Gray(8, "["+strings.Join(source, " ")+"]"))
+}
+
+// tagLogLine function adds name of source pod and name of source file into
+// JSON log line; empty names are not added. Attributes already present in
+// the line take precedence, as the first occurrence is overridden by the
+// next one during parsing. Other lines are returned unchanged.
+func tagLogLine(line, pod, file string) string {
+	if !strings.HasPrefix(line, "{") {
+		return line
+	}
+	tags := ""
+	for _, tag := range []struct{ key, value string }{{"pod", pod}, {"source_file", file}} {
+		if tag.value == "" {
+			continue
+		}
+		value, err := json.Marshal(tag.value)
+		if err != nil {
+			return line
+		}
+		tags += `"` + tag.key + `":` + string(value) + ","
+	}
+	if tags == "" {
+		return line
+	}
+	rest := strings.TrimSpace(line[1:])
+	if strings.HasPrefix(rest, "}") {
+		return "{" + strings.TrimSuffix(tags, ",") + rest
+	}
+	return "{" + tags + rest
+}
+
+// rotatedLogSuffix matches extension of log file followed by suffix added
+// to name of rotated log file, like .1 or -20220301, and by compression
+// extension
+var rotatedLogSuffix = regexp.MustCompile(`(\.[A-Za-z]+)([.-][0-9-]+)?(\.gz|\.zst|\.zstd)?$`)
+
+// logChain function returns name shared by all files of one log, i.e. by
+// the log file and its rotated or compressed copies. Logs retrieved from
+// pods are identified by pod.
+func logChain(source LogSource) string {
+	if source.Pod != "" {
+		return source.Pod
+	}
+	return rotatedLogSuffix.ReplaceAllString(filepath.Base(source.Filename), "$1")
+}
+
+// duplicateKey identifies line of one log
+type duplicateKey struct {
+	chain string
+	line  string
+}
+
+// duplicateFilter recognizes lines that have been already written from
+// another file of the same log, for example from overlapping rotated log
+// files. Files of different logs, like logs of different pods, can contain
+// the same lines, that are not duplicate. Lines are compared with other
+// lines with the same time only, so just lines with the current time are
+// kept in memory.
+type duplicateFilter struct {
+	time  time.Time
+	lines map[duplicateKey]int
+}
+
+// duplicate method checks whether the line from given source has been
+// already written from another file of the same log. Lines without time
+// are never considered duplicate.
+func (filter *duplicateFilter) duplicate(line string, t time.Time, source int, chain string) bool {
+	if t.IsZero() {
+		return false
+	}
+	if !t.Equal(filter.time) || filter.lines == nil {
+		filter.time = t
+		filter.lines = make(map[duplicateKey]int)
+	}
+	key := duplicateKey{chain, line}
+	written, found := filter.lines[key]
+	if found && written != source {
+		return true
+	}
+	filter.lines[key] = source
+	return false
+}
+
+// next method reads the next line from the source. When logs of previous
+// container instance end, restart marker is returned as the last line.
+func (source *sourceReader) next(format logFormat) error {
+	if source.marker {
+		source.done = true
+		return nil
+	}
+
+	line, err := source.reader.ReadString('\n')
+	if line == "" && err == io.EOF {
+		if source.Previous && !source.time.IsZero() {
+			source.line = format.restartMarker(source.Pod, source.time)
+			source.marker = true
+			return nil
+		}
+		source.done = true
+		return nil
+	}
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	source.line = strings.TrimRight(line, "\r\n")
+	t := format.timeOf(source.line)
+	if !t.IsZero() {
+		source.time = t
+	}
+	return nil
+}
+
+// mergeLogFiles function merges log files from several pods into one file
+// ordered by time. Each JSON line is tagged by its source pod and file. Just
+// one line from each source is kept in memory. When requested, lines
+// already written from another file of the same log are skipped; number of
+// skipped lines is returned.
+func mergeLogFiles(sources []LogSource, output string, format logFormat, deduplicate bool) (duplicates int, err error) {
+	readers := make([]*sourceReader, 0, len(sources))
+	defer func() {
+		for _, source := range readers {
+			closeErr := source.file.Close()
+			if closeErr != nil {
+				log.Println(closeErr)
+			}
+		}
+	}()
+
+	for _, source := range sources {
+		file, err := openLogFile(source.Filename)
+		if err != nil {
+			return 0, err
+		}
+		reader := &sourceReader{
+			LogSource: source,
+			chain:     logChain(source),
+			file:      file,
+			reader:    bufio.NewReader(file),
+		}
+		readers = append(readers, reader)
+		err = reader.next(format)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	// disable "G304 (CWE-22): Potential file inclusion via variable"
+	file, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600) // #nosec G304
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		closeErr := file.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+	writer := bufio.NewWriter(file)
+	var filter duplicateFilter
+
+	for {
+		// number of sources is small, so linear search is sufficient
+		oldest := -1
+		for i, source := range readers {
+			if !source.done && (oldest < 0 || source.time.Before(readers[oldest].time)) {
+				oldest = i
+			}
+		}
+		if oldest < 0 {
+			return duplicates, writer.Flush()
+		}
+
+		source := readers[oldest]
+		if deduplicate && filter.duplicate(source.line, source.time, oldest, source.chain) {
+			duplicates++
+		} else {
+			_, err := writer.WriteString(tagLogLine(source.line, source.Pod, source.File) + "\n")
+			if err != nil {
+				return duplicates, err
+			}
+		}
+		err = source.next(format)
+		if err != nil {
+			return duplicates, err
+		}
+	}
+}
+
+// marshalMarker function converts restart marker entry into log line
+func marshalMarker(entry interface{}) string {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return containerRestarted
+	}
+	return string(line)
+}
+
+// aggregatorLogFormat is used to merge aggregator logs
+var aggregatorLogFormat = logFormat{
+	timeOf: func(line string) time.Time {
+		entry, err := parseAggregatorLogEntry(line)
+		if err != nil {
+			return time.Time{}
+		}
+		return entry.Timestamp
+	},
+	restartMarker: func(pod string, t time.Time) string {
+		return marshalMarker(map[string]string{
+			"level":   entryLevelWarning,
+			"time":    t.UTC().Format(aggregatorTimeFormat),
+			"message": containerRestarted,
+		})
+	},
+}
+
+// pipelineLogFormat is used to merge CCX data pipeline logs
+var pipelineLogFormat = logFormat{
+	timeOf: func(line string) time.Time {
+		entry, err := parsePipelineLogEntry(line)
+		if err != nil {
+			return time.Time{}
+		}
+		return entry.Timestamp
+	},
+	restartMarker: func(pod string, t time.Time) string {
+		return marshalMarker(map[string]string{
+			"levelname": pipelineLevelWarning,
+			"asctime":   t.UTC().Format(pipelineTimeFormats[0]),
+			"message":   containerRestarted,
+		})
+	},
+}
+
+// MergeAggregatorLogFiles function merges aggregator logs retrieved from
+// all replicas into one file ordered by time. Logs of previous container
+// instances are terminated by restart marker.
+func MergeAggregatorLogFiles(sources []LogSource, output string) error {
+	_, err := mergeLogFiles(sources, output, aggregatorLogFormat, false)
+	return err
+}
+
+// MergePipelineLogFiles function merges CCX data pipeline logs retrieved
+// from all replicas into one file ordered by time. Logs of previous
+// container instances are terminated by restart marker.
+func MergePipelineLogFiles(sources []LogSource, output string) error {
+	_, err := mergeLogFiles(sources, output, pipelineLogFormat, false)
+	return err
+}
+
+// LogStream represents logs followed in one pod
+type LogStream struct {
+	Pod    string
+	Stream io.ReadCloser
+}
+
+// mergedStream contains lines from several followed pods. Closing the
+// merged stream closes all pod streams; it can be closed repeatedly.
+type mergedStream struct {
+	*io.PipeReader
+	streams []LogStream
+	once    sync.Once
+	err     error
+}
+
+// Close method stops following logs in all pods
+func (merged *mergedStream) Close() error {
+	merged.once.Do(func() {
+		for _, stream := range merged.streams {
+			err := stream.Stream.Close()
+			if err != nil && merged.err == nil {
+				merged.err = err
+			}
+		}
+		err := merged.PipeReader.Close()
+		if merged.err == nil {
+			merged.err = err
+		}
+	})
+	return merged.err
+}
+
+// MergeLogStreams function merges logs followed in several pods into one
+// stream. Unlike merged log files, lines are passed in the order they
+// arrive, as followed logs never end. Each JSON line is tagged by its
+// source pod, so the lines can be processed per pod the same way as lines
+// of merged log files. The merged stream ends when all pod streams end.
+func MergeLogStreams(streams []LogStream) io.ReadCloser {
+	reader, writer := io.Pipe()
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	var firstErr error
+
+	for _, stream := range streams {
+		wg.Add(1)
+		go func(stream LogStream) {
+			defer wg.Done()
+			buffered := bufio.NewReader(stream.Stream)
+			for {
+				line, err := buffered.ReadString('\n')
+				if line != "" {
+					line = tagLogLine(strings.TrimRight(line, "\r\n"), stream.Pod, "")
+					// lines from several pods are never mixed
+					mutex.Lock()
+					_, writeErr := io.WriteString(writer, line+"\n")
+					mutex.Unlock()
+					if writeErr != nil {
+						// merged stream has been closed
+						return
+					}
+				}
+				if err != nil {
+					mutex.Lock()
+					if err != io.EOF && firstErr == nil {
+						firstErr = fmt.Errorf("%s: %v", stream.Pod, err)
+					}
+					mutex.Unlock()
+					return
+				}
+			}
+		}(stream)
+	}
+
+	go func() {
+		wg.Wait()
+		_ = writer.CloseWithError(firstErr)
+	}()
+	return &mergedStream{PipeReader: reader, streams: streams}
+}
@@ -0,0 +1,276 @@
+// Copyright 2020, 2021, 2022 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package analyser
+
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/ccx-data-pipeline-monitor/packages/analyser/parse_report.html
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/logrusorgru/aurora"
+)
+
+// Limits of parse report
+const (
+	// maximum number of samples kept for each kind of problem
+	parseReportSamples = 5
+
+	// maximum length of sampled line
+	sampleLength = 160
+)
+
+// lineSample contains one line of log file displayed in parse report
+type lineSample struct {
+	number int
+	text   string
+	err    string
+}
+
+// crashContext describes what the service was doing when plain text block
+// has been written, that is the last log entry before the block and the
+// last message processed by the same pod
+type crashContext struct {
+	time      int64
+	pod       string
+	processed string
+}
+
+// textBlock represents consecutive plain text lines (for example Go panic
+// or Python traceback) stored in log file
+type textBlock struct {
+	location int64
+	lines    int
+	context  crashContext
+}
+
+// parseReport contains number of lines of log file that are not regular
+// JSON records together with samples of such lines
+type parseReport struct {
+	lines            int
+	records          int
+	malformed        int
+	malformedSamples []lineSample
+	textLines        int
+	textBlocks       int
+	textSamples      []lineSample
+}
+
+// logLines processes lines of log file before they are indexed. JSON
+// records are parsed, malformed JSON lines are counted and sampled, and
+// plain text lines are attached to the closest JSON record: to the
+// preceding one, or to the following one at the beginning of the file.
+type logLines struct {
+	report     parseReport
+	blocks     []textBlock
+	attached   map[int64][]int
+	lastRecord int64
+	block      int
+	pending    []int
+}
+
+// noBlock marks that no plain text block is being read at the moment
+const noBlock = -1
+
+// newLogLines function constructs empty line processor
+func newLogLines() logLines {
+	return logLines{
+		attached:   make(map[int64][]int),
+		lastRecord: -1,
+		block:      noBlock,
+	}
+}
+
+// sample function shortens line to be displayed in parse report
+func sample(number int, line string, err error) lineSample {
+	text := line
+	if len(text) > sampleLength {
+		text = text[:sampleLength] + "..."
+	}
+	s := lineSample{number: number, text: text}
+	if err != nil {
+		s.err = err.Error()
+	}
+	return s
+}
+
+// scan method processes one line of log file stored at given location.
+// Lines starting with '{' are parsed by the parse callback, the callback
+// is expected to index the record. When the line starts new plain text
+// block, the block is returned, so the caller can fill in its context.
+func (lines *logLines) scan(line string, location int64, parse func(line string) error) *textBlock {
+	lines.report.lines++
+	trimmed := strings.TrimSpace(line)
+	if trimmed == "" {
+		// empty lines can separate parts of stack trace
+		if lines.block != noBlock {
+			lines.blocks[lines.block].lines++
+		}
+		return nil
+	}
+
+	if strings.HasPrefix(trimmed, "{") {
+		lines.block = noBlock
+		err := parse(line)
+		if err != nil {
+			lines.report.malformed++
+			if len(lines.report.malformedSamples) < parseReportSamples {
+				lines.report.malformedSamples = append(lines.report.malformedSamples, sample(lines.report.lines, line, err))
+			}
+			return nil
+		}
+		lines.report.records++
+		lines.lastRecord = location
+		// text at the beginning of file belongs to the first record
+		if len(lines.pending) > 0 {
+			lines.attached[location] = lines.pending
+			lines.pending = nil
+		}
+		return nil
+	}
+
+	lines.report.textLines++
+	if lines.block != noBlock {
+		lines.blocks[lines.block].lines++
+		return nil
+	}
+
+	lines.report.textBlocks++
+	if len(lines.report.textSamples) < parseReportSamples {
+		lines.report.textSamples = append(lines.report.textSamples, sample(lines.report.lines, line, nil))
+	}
+	lines.block = len(lines.blocks)
+	lines.blocks = append(lines.blocks, textBlock{location: location, lines: 1})
+	if lines.lastRecord < 0 {
+		lines.pending = append(lines.pending, lines.block)
+	} else {
+		lines.attached[lines.lastRecord] = append(lines.attached[lines.lastRecord], lines.block)
+	}
+	return &lines.blocks[lines.block]
+}
+
+// blockText function reads all non-empty lines of given plain text block
+func blockText(reader *logReader, block *textBlock) ([]string, error) {
+	blockLines, err := reader.lines(block.location, block.lines)
+	if err != nil {
+		return nil, err
+	}
+	text := make([]string, 0, len(blockLines))
+	for _, line := range blockLines {
+		if strings.TrimSpace(line) != "" {
+			text = append(text, line)
+		}
+	}
+	return text, nil
+}
+
+// text method reads all plain text lines attached to the record at given
+// location
+func (lines *logLines) text(reader *logReader, location int64) ([]string, error) {
+	text := []string{}
+	for _, block := range lines.attached[location] {
+		blockLines, err := blockText(reader, &lines.blocks[block])
+		if err != nil {
+			return nil, err
+		}
+		text = append(text, blockLines...)
+	}
+	return text, nil
+}
+
+// printAttachedText function prints plain text lines attached to the
+// record at given location, for example stack trace of panic
+func printAttachedText(colorizer aurora.Aurora, reader *logReader, lines *logLines, location int64) error {
+	text, err := lines.text(reader, location)
+	if err != nil {
+		return err
+	}
+	for _, line := range text {
+		fmt.Printf("\t\t%s\n", colorizer.Red(line))
+	}
+	return nil
+}
+
+func printLineSamples(colorizer aurora.Aurora, samples []lineSample) {
+	for _, s := range samples {
+		fmt.Printf("%12s  %s", colorizer.Blue("line "+strconv.Itoa(s.number)), s.text)
+		if s.err != "" {
+			fmt.Print("  ", colorizer.Red(s.err))
+		}
+		fmt.Println()
+	}
+}
+
+// printParseReport function prints number of malformed and plain text
+// lines found in log file together with their samples
+func printParseReport(colorizer aurora.Aurora, title string, lines *logLines) {
+	report := &lines.report
+	fmt.Println(colorizer.Blue(title))
+	fmt.Printf("%-18s %s\n", "Lines", colorizer.Blue(strconv.Itoa(report.lines)))
+	fmt.Printf("%-18s %s\n", "JSON records", colorizer.Blue(strconv.Itoa(report.records)))
+	fmt.Printf("%-18s %s\n", "Malformed lines", colorizer.Red(strconv.Itoa(report.malformed)))
+	printLineSamples(colorizer, report.malformedSamples)
+	fmt.Printf("%-18s %s in %s blocks attached to records\n", "Plain text lines", colorizer.Yellow(strconv.Itoa(report.textLines)), colorizer.Yellow(strconv.Itoa(report.textBlocks)))
+	printLineSamples(colorizer, report.textSamples)
+	fmt.Println()
+}
+
+// PrintParseReport function prints parse report for loaded aggregator, CCX
+// data pipeline, and other services logs
+func PrintParseReport(colorizer aurora.Aurora) {
+	loaded := false
+	if aggregatorStageIndex != nil {
+		printParseReport(colorizer, "Aggregator logs", &aggregatorStageIndex.lines)
+		loaded = true
+	}
+	if pipelineStageIndex != nil {
+		printParseReport(colorizer, "CCX data pipeline logs", &pipelineStageIndex.lines)
+		loaded = true
+	}
+	for _, service := range genericServices {
+		if service.index != nil {
+			printParseReport(colorizer, service.config.Name+" logs", &service.index.lines)
+			loaded = true
+		}
+	}
+	if !loaded {
+		fmt.Println(colorizer.Red(logsAreNotLoaded))
+	}
+}
+
+// problems method returns number of malformed and plain text lines
+func (lines *logLines) problems() (malformed, text int) {
+	return lines.report.malformed, lines.report.textLines
+}
+
+// AggregatorParseProblems function returns number of malformed and plain
+// text lines found in loaded aggregator logs
+func AggregatorParseProblems() (malformed, text int) {
+	if aggregatorStageIndex == nil {
+		return 0, 0
+	}
+	return aggregatorStageIndex.lines.problems()
+}
+
+// PipelineParseProblems function returns number of malformed and plain text
+// lines found in loaded CCX data pipeline logs
+func PipelineParseProblems() (malformed, text int) {
+	if pipelineStageIndex == nil {
+		return 0, 0
+	}
+	return pipelineStageIndex.lines.problems()
+}
@@ -18,122 +18,236 @@ package analyser
 // https://redhatinsights.github.io/ccx-data-pipeline-monitor/packages/analyser/pipeline.html
 
 import (
-	"bufio"
 	"encoding/json"
 	"fmt"
-	"log"
-	"os"
 	"strconv"
-	"strings"
+	"time"
 
 	"github.com/logrusorgru/aurora"
 
 	"github.com/RedHatInsights/ccx-data-pipeline-monitor/config"
 )
 
+// Log levels for analyzed files
+const (
+	pipelineLevelError   = "ERROR"
+	pipelineLevelWarning = "WARNING"
+)
+
+// pipelineTimeFormats contains the default format of Python asctime and its
+// variant with decimal point. Timestamps don't contain timezone, so UTC is
+// assumed.
+var pipelineTimeFormats = []string{
+	"2006-01-02 15:04:05,000",
+	"2006-01-02 15:04:05.000",
+}
+
 // PipelineLogEntry represents one log entry (record) read from log file.
 type PipelineLogEntry struct {
-	Level    string `json:"levelname"`
-	Time     string `json:"asctime"`
-	Name     string `json:"name"`
-	Filename string `json:"filename"`
-	Message  string `json:"message"`
+	Level      string `json:"levelname"`
+	Time       string `json:"asctime"`
+	Name       string `json:"name"`
+	Filename   string `json:"filename"`
+	Message    string `json:"message"`
+	Pod        string `json:"pod"`
+	SourceFile string `json:"source_file"`
+
+	// Timestamp contains parsed Time, it is zero when Time can't be parsed
+	Timestamp time.Time `json:"-"`
 }
 
-var pipelineEntries []PipelineLogEntry = nil
+var pipelineStageIndex *pipelineIndex = nil
 
-func readPipelineLogFile(filename string) ([]PipelineLogEntry, error) {
-	entries := []PipelineLogEntry{}
+// parsePipelineTime function parses timestamp used in CCX data pipeline logs
+func parsePipelineTime(timestamp string) (time.Time, error) {
+	var t time.Time
+	var err error
+	for _, format := range pipelineTimeFormats {
+		t, err = time.Parse(format, timestamp)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return t, err
+}
 
-	// disable "G304 (CWE-22): Potential file inclusion via variable"
-	file, err := os.Open(filename) // #nosec G304
+func parsePipelineLogEntry(text string) (PipelineLogEntry, error) {
+	entry := PipelineLogEntry{}
+	err := json.Unmarshal([]byte(text), &entry)
 	if err != nil {
-		return entries, err
+		return entry, err
 	}
 
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		entry := PipelineLogEntry{}
-		err = json.Unmarshal([]byte(scanner.Text()), &entry)
-		if err != nil {
-			log.Println(err)
-		} else {
-			entries = append(entries, entry)
-		}
-	}
+	// entries with unknown time are still useful
+	entry.Timestamp, _ = parsePipelineTime(entry.Time)
+	return entry, nil
+}
+
+// readPipelineLogFile function reads the log file entry by entry and builds
+// index for all entries. Entries themselves are not kept in memory.
+func readPipelineLogFile(filename string) (*pipelineIndex, error) {
+	index := newPipelineIndex(filename)
 
-	if err := scanner.Err(); err != nil {
-		return entries, err
+	err := scanLogFile(filename, index.scan)
+	if err != nil {
+		return nil, err
 	}
 
-	// log file needs to be closed properly
+	return index, nil
+}
 
-	// try to close the file
-	err = file.Close()
+// minimal width of the first column of CCX data pipeline statistic
+const pipelineStatisticWidth = 26
 
-	// in case of error all we can do is to just log the error
-	if err != nil {
-		log.Println(err)
+func printStatisticLinePipeline(colorizer aurora.Aurora, width int, what string, count int) {
+	e := strconv.Itoa(count)
+	fmt.Printf("%-*s %s messages\n", width, what, colorizer.Blue(e))
+}
+
+// statisticWidth method returns width of the first column of statistic
+func (index *pipelineIndex) statisticWidth() int {
+	if width := index.funnel.nameWidth(); width > pipelineStatisticWidth {
+		return width
 	}
+	return pipelineStatisticWidth
+}
 
-	return entries, nil
+// printPipelineStatistic function prints number of messages logged for
+// each funnel stage
+func printPipelineStatistic(colorizer aurora.Aurora, index *pipelineIndex, window TimeWindow) {
+	width := index.statisticWidth()
+	for stage := range index.funnel.stages {
+		printStatisticLinePipeline(colorizer, width, index.funnel.stages[stage].name, index.count(stage, window))
+	}
+	printPipelineRestarts(colorizer, index, window)
 }
 
-func filterPipelineMessagesByMessage(entries []PipelineLogEntry, prefix string) []PipelineLogEntry {
-	filtered := []PipelineLogEntry{}
+// printPipelineRestarts function prints all container restarts within given
+// time window together with the trace interrupted by the restart
+func printPipelineRestarts(colorizer aurora.Aurora, index *pipelineIndex, window TimeWindow) {
+	for _, restart := range index.restarts {
+		t, _ := parsePipelineTime(restart.time)
+		if !window.contains(t) {
+			continue
+		}
+		interrupted := "no trace interrupted"
+		if restart.interrupted != nil {
+			interrupted = "interrupted " + restart.interrupted.ID()
+		}
+		fmt.Printf("%-*s %s  %s  %s\n", index.statisticWidth(), "Restart", colorizer.Gray(8, restart.time), restart.pod, colorizer.Red(interrupted))
+	}
+}
 
-	for _, entry := range entries {
-		if strings.HasPrefix(entry.Message, prefix) {
-			filtered = append(filtered, entry)
+// getPipelineTracesStuckAt function returns all traces started within given
+// time window that reached the given stage, but that did not reach the next
+// stage
+func getPipelineTracesStuckAt(index *pipelineIndex, stage, nextStage int, window TimeWindow) []*PipelineTrace {
+	stuck := []*PipelineTrace{}
+
+	for _, trace := range index.tracesWithin(window) {
+		if trace.has(stage) && !trace.has(nextStage) {
+			stuck = append(stuck, trace)
 		}
 	}
-	return filtered
+	return stuck
 }
 
-func printStatisticLinePipeline(colorizer aurora.Aurora, what string, entries []PipelineLogEntry) {
-	e := strconv.Itoa(len(entries))
-	fmt.Printf("%-26s %s messages\n", what, colorizer.Blue(e))
+func printPipelineEntry(colorizer aurora.Aurora, i int, entry *PipelineLogEntry) {
+	e := strconv.Itoa(i)
+	fmt.Printf("%5s  %s  %s  %s  %s", colorizer.Blue(e), colorizer.Gray(8, entry.Time), colorizer.Cyan(entry.Name), colorizer.Yellow(entry.Filename), entry.Message)
+	printEntrySource(colorizer, entry.Pod, entry.SourceFile)
 }
 
-func printPipelineStatistic(colorizer aurora.Aurora, entries []PipelineLogEntry) {
-	validated1 := filterPipelineMessagesByMessage(entries, "JSON schema validated")
-	validated2 := filterPipelineMessagesByMessage(entries, "Identity schema validated")
-	downloaded := filterPipelineMessagesByMessage(entries, "Downloading ")
-	saved := filterPipelineMessagesByMessage(entries, "Saved ")
-	sendStart := filterPipelineMessagesByMessage(entries, "Sending response to the ")
-	sendSuccess := filterPipelineMessagesByMessage(entries, "Message has been sent successfully")
-	contextRetrieved := filterPipelineMessagesByMessage(entries, "Message context: ")
-	success := filterPipelineMessagesByMessage(entries, "Status: Success; ")
+func printPipelineErrors(colorizer aurora.Aurora, reader pipelineReader, index *pipelineIndex, trace *PipelineTrace) error {
+	for _, location := range trace.errors {
+		entry, err := reader.entry(location)
+		if err != nil {
+			return err
+		}
+		fmt.Printf(timeAndMessageTemplate, colorizer.Gray(8, entry.Time), colorizer.Red(entry.Message))
+		err = printAttachedText(colorizer, reader.logReader, &index.lines, location)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func printPipelineMessagesStuckAt(colorizer aurora.Aurora, index *pipelineIndex, stage, nextStage int, window TimeWindow) error {
+	reader, err := index.open()
+	if err != nil {
+		return err
+	}
+	defer reader.close()
 
-	printStatisticLinePipeline(colorizer, "JSON schema validated", validated1)
-	printStatisticLinePipeline(colorizer, "Identity schema validated", validated2)
-	printStatisticLinePipeline(colorizer, "Downloaded", downloaded)
-	printStatisticLinePipeline(colorizer, "Saved", saved)
-	printStatisticLinePipeline(colorizer, "Sending start", sendStart)
-	printStatisticLinePipeline(colorizer, "Sending successful", sendSuccess)
-	printStatisticLinePipeline(colorizer, "Context retrieved", contextRetrieved)
-	printStatisticLinePipeline(colorizer, "Success", success)
+	stuck := getPipelineTracesStuckAt(index, stage, nextStage, window)
+	for i, trace := range stuck {
+		entry, err := reader.entry(trace.steps[stage])
+		if err != nil {
+			return err
+		}
+		printPipelineEntry(colorizer, i+1, entry)
+		err = printPipelineErrors(colorizer, reader, index, trace)
+		if err != nil {
+			return err
+		}
+	}
+	fmt.Println()
+	return nil
 }
 
 // ReadPipelineLogFiles reads all log files gathered from CCX data pipeline pods.
-func ReadPipelineLogFiles() (int, error) {
-	var err error
-	pipelineEntries, err = readPipelineLogFile(config.PipelineLogFileName)
+// When log files are given, they are merged into pipeline.log first and
+// number of skipped duplicate lines is returned too.
+func ReadPipelineLogFiles(filenames ...string) (entries, duplicates int, err error) {
+	if len(filenames) > 0 {
+		duplicates, err = loadLogFiles(filenames, config.PipelineLogFileName, pipelineLogFormat)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+	pipelineStageIndex, err = readPipelineLogFile(config.PipelineLogFileName)
 	if err != nil {
-		return 0, err
+		return 0, duplicates, err
 	}
-	return len(pipelineEntries), nil
+	return pipelineStageIndex.entries, duplicates, nil
 }
 
-// PrintPipelineStatistic prints statistic gathered from CCX data pipeline logs.
-func PrintPipelineStatistic(colorizer aurora.Aurora) {
-	if pipelineEntries == nil {
+// PrintPipelineStatistic prints statistic gathered from CCX data pipeline logs
+// within given time window.
+func PrintPipelineStatistic(colorizer aurora.Aurora, window TimeWindow) {
+	if pipelineStageIndex == nil {
 		fmt.Println(colorizer.Red("logs are not loaded"))
 		return
 	}
-	if len(pipelineEntries) == 0 {
+	if pipelineStageIndex.entries == 0 {
 		fmt.Println(colorizer.Red("empty log"))
 		return
 	}
-	printPipelineStatistic(colorizer, pipelineEntries)
+	printPipelineStatistic(colorizer, pipelineStageIndex, window)
+}
+
+// PrintPipelineStuckMessages function prints all messages that passed
+// through given transition of CCX data pipeline funnel only halfway, for
+// example messages whose archive has been downloaded, but not saved.
+// Transitions are numbered from zero in the order returned by
+// PipelineFunnelTransitions.
+func PrintPipelineStuckMessages(colorizer aurora.Aurora, window TimeWindow, transition int) {
+	if pipelineStageIndex == nil {
+		fmt.Println(colorizer.Red(logsAreNotLoaded))
+		return
+	}
+	if pipelineStageIndex.entries == 0 {
+		fmt.Println(colorizer.Red(emptyLog))
+		return
+	}
+	transitions := pipelineStageIndex.funnel.transitions()
+	if transition < 0 || transition >= len(transitions) {
+		fmt.Println(colorizer.Red(unknownTransition))
+		return
+	}
+	err := printPipelineMessagesStuckAt(colorizer, pipelineStageIndex, transitions[transition][0], transitions[transition][1], window)
+	if err != nil {
+		fmt.Println(colorizer.Red(err))
+	}
 }
@@ -0,0 +1,476 @@
+// Copyright 2020, 2021, 2022 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package analyser
+
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/ccx-data-pipeline-monitor/packages/analyser/pipeline_trace.html
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/logrusorgru/aurora"
+)
+
+// Kinds of keys that can be used to correlate log entries
+const (
+	traceKeyURL       = "archive"
+	traceKeyRequestID = "request"
+	traceKeyClusterID = "cluster"
+)
+
+// Regular expressions used to find correlation keys in log messages
+var (
+	urlRegexp       = regexp.MustCompile(`https?://[^\s'"]+`)
+	requestIDRegexp = regexp.MustCompile(`(?i)request[_ ]?id['"]?\s*[:=]\s*['"]?([\w-]+)`)
+	clusterIDRegexp = regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`)
+	orgIDRegexp     = regexp.MustCompile(`(?i)org(?:anization)?[_ ]?id['"]?\s*[:=]\s*['"]?(\d+)`)
+)
+
+// notLogged marks message that has not been logged for given trace
+const notLogged = -1
+
+// traceKey represents one key (archive URL, request ID, or cluster ID) found
+// in log message
+type traceKey struct {
+	kind  string
+	value string
+}
+
+// PipelineTrace represents all log entries produced by CCX data pipeline
+// during processing of one incoming archive. Entries are not stored in the
+// trace, just their locations in log file.
+type PipelineTrace struct {
+	URL          string
+	RequestID    string
+	ClusterID    string
+	Organization int
+	Started      string
+	started      int64
+	steps        []int64
+	errors       []int64
+	interrupted  bool
+	funnel       *funnel
+
+	// values of key fields configured for funnel stages
+	fields map[string]string
+}
+
+// pipelineRestart represents restart of CCX data pipeline container
+// together with the trace that was being processed at that moment
+type pipelineRestart struct {
+	pod         string
+	time        string
+	interrupted *PipelineTrace
+}
+
+// pipelineIndex contains aggregated information about all CCX data pipeline
+// log entries: times of entries for each message type, per-archive traces,
+// and container restarts. Traces are built incrementally as entries are
+// added. Each pod processes its own trace at the moment.
+type pipelineIndex struct {
+	filename string
+	entries  int
+	funnel   *funnel
+	times    [][]int64
+	traces   []*PipelineTrace
+	byKey    map[traceKey]*PipelineTrace
+	current  map[string]*PipelineTrace
+	restarts []pipelineRestart
+	lines    logLines
+	lastPod  string
+	lastTime int64
+}
+
+// extractTraceKeys function tries to find archive URL, request ID, and
+// cluster ID in given log message
+func extractTraceKeys(message string) []traceKey {
+	keys := []traceKey{}
+
+	url := urlRegexp.FindString(message)
+	if url != "" {
+		keys = append(keys, traceKey{traceKeyURL, url})
+	}
+
+	requestID := requestIDRegexp.FindStringSubmatch(message)
+	if requestID != nil {
+		keys = append(keys, traceKey{traceKeyRequestID, requestID[1]})
+	}
+
+	// UUIDs that are part of archive URL are not cluster IDs
+	clusterID := clusterIDRegexp.FindString(urlRegexp.ReplaceAllString(message, ""))
+	if clusterID != "" {
+		keys = append(keys, traceKey{traceKeyClusterID, strings.ToLower(clusterID)})
+	}
+
+	return keys
+}
+
+// extractOrganization function tries to find organization ID in given log
+// message. Zero is returned when organization ID is not found.
+func extractOrganization(message string) int {
+	orgID := orgIDRegexp.FindStringSubmatch(message)
+	if orgID == nil {
+		return 0
+	}
+	organization, err := strconv.Atoi(orgID[1])
+	if err != nil {
+		return 0
+	}
+	return organization
+}
+
+// key method returns the trace key of given kind, or an empty string when
+// such key is not known
+func (trace *PipelineTrace) key(kind string) string {
+	switch kind {
+	case traceKeyURL:
+		return trace.URL
+	case traceKeyRequestID:
+		return trace.RequestID
+	case traceKeyClusterID:
+		return trace.ClusterID
+	}
+	return trace.fields[kind]
+}
+
+func (trace *PipelineTrace) setKey(key traceKey) {
+	switch key.kind {
+	case traceKeyURL:
+		trace.URL = key.value
+	case traceKeyRequestID:
+		trace.RequestID = key.value
+	case traceKeyClusterID:
+		trace.ClusterID = key.value
+	default:
+		if trace.fields == nil {
+			trace.fields = make(map[string]string)
+		}
+		trace.fields[key.kind] = key.value
+	}
+}
+
+// identifiesArchive method checks whether the key belongs to one archive
+// only. Cluster sends many archives, so cluster ID just describes the trace.
+func (key traceKey) identifiesArchive() bool {
+	return key.kind != traceKeyClusterID
+}
+
+// conflictsWith method checks whether the trace has been already assigned
+// a different key of the same kind
+func (trace *PipelineTrace) conflictsWith(keys []traceKey) bool {
+	for _, key := range keys {
+		value := trace.key(key.kind)
+		if value != "" && value != key.value {
+			return true
+		}
+	}
+	return false
+}
+
+// ID method returns the most specific key known for the trace
+func (trace *PipelineTrace) ID() string {
+	switch {
+	case trace.RequestID != "":
+		return trace.RequestID
+	case trace.URL != "":
+		return trace.URL
+	case trace.ClusterID != "":
+		return trace.ClusterID
+	}
+	return "unknown"
+}
+
+// has method checks whether given funnel stage has been logged for the trace
+func (trace *PipelineTrace) has(stage int) bool {
+	return trace.steps[stage] != notLogged
+}
+
+// MissingStep method returns the first required funnel stage that was not
+// logged for the traced archive, or an empty string for complete traces
+func (trace *PipelineTrace) MissingStep() string {
+	for _, stage := range trace.funnel.chain() {
+		if !trace.has(stage) {
+			return strings.ToLower(trace.funnel.stages[stage].name)
+		}
+	}
+	return ""
+}
+
+func newPipelineTrace(entry *PipelineLogEntry, f *funnel) *PipelineTrace {
+	trace := PipelineTrace{
+		Started: entry.Time,
+		started: unixNano(entry.Timestamp),
+		steps:   make([]int64, len(f.stages)),
+		funnel:  f,
+	}
+	for i := range trace.steps {
+		trace.steps[i] = notLogged
+	}
+	return &trace
+}
+
+// newPipelineIndex function constructs empty index for given log file.
+// Entries are split into stages of the configured CCX data pipeline
+// funnel.
+func newPipelineIndex(filename string) *pipelineIndex {
+	return &pipelineIndex{
+		filename: filename,
+		funnel:   pipelineFunnel,
+		times:    make([][]int64, len(pipelineFunnel.stages)),
+		byKey:    make(map[traceKey]*PipelineTrace),
+		current:  make(map[string]*PipelineTrace),
+		lines:    newLogLines(),
+	}
+}
+
+// find method returns already known trace with any of given keys. Only keys
+// that identify one archive are used, nil is returned when no such trace is
+// known.
+func (index *pipelineIndex) find(keys []traceKey) *PipelineTrace {
+	for _, key := range keys {
+		if trace, found := index.byKey[key]; found {
+			return trace
+		}
+	}
+	return nil
+}
+
+// add method updates the index by one log entry stored at given location.
+// Entries belong to the trace that is being processed at the moment in the
+// same pod, because CCX data pipeline processes incoming messages
+// sequentially. Entry of the first funnel stage always starts a new trace.
+// Entry with keys, found in its message or in key fields of funnel stages,
+// that conflict with the current trace belongs to the known trace of the
+// same archive, or starts a new one. Container restart interrupts the
+// current trace.
+func (index *pipelineIndex) add(entry *PipelineLogEntry, fields logFields, location int64) {
+	index.entries++
+	index.lastPod = entry.Pod
+	index.lastTime = unixNano(entry.Timestamp)
+
+	if entry.Message == containerRestarted {
+		restart := pipelineRestart{
+			pod:  entry.Pod,
+			time: entry.Time,
+		}
+		current := index.current[entry.Pod]
+		if current != nil && current.MissingStep() != "" {
+			current.interrupted = true
+			restart.interrupted = current
+		}
+		index.restarts = append(index.restarts, restart)
+		delete(index.current, entry.Pod)
+		return
+	}
+
+	keys := extractTraceKeys(entry.Message)
+	for _, field := range index.funnel.keyFields() {
+		if value := fields.value(field); value != "" {
+			keys = append(keys, traceKey{field, value})
+		}
+	}
+	stage, ok := index.funnel.classify(fields)
+
+	// the trace being processed by the pod takes precedence over already
+	// known traces
+	current := index.current[entry.Pod]
+	newMessage := ok && stage == index.funnel.first
+	trace := current
+	if current == nil || newMessage || current.conflictsWith(keys) {
+		trace = nil
+		if !newMessage {
+			trace = index.find(keys)
+		}
+		if trace == nil {
+			trace = newPipelineTrace(entry, index.funnel)
+			index.traces = append(index.traces, trace)
+		}
+	}
+
+	for _, key := range keys {
+		if trace.key(key.kind) == "" {
+			trace.setKey(key)
+			if key.identifiesArchive() {
+				index.byKey[key] = trace
+			}
+		}
+	}
+	if trace.Organization == 0 {
+		trace.Organization = extractOrganization(entry.Message)
+	}
+
+	if ok {
+		index.times[stage] = append(index.times[stage], unixNano(entry.Timestamp))
+		if !trace.has(stage) {
+			trace.steps[stage] = location
+		}
+	}
+	if entry.Level == pipelineLevelError {
+		trace.errors = append(trace.errors, location)
+	}
+	index.current[entry.Pod] = trace
+}
+
+// processing method checks whether the trace is being processed at the
+// moment by any pod
+func (index *pipelineIndex) processing(trace *PipelineTrace) bool {
+	for _, current := range index.current {
+		if current == trace {
+			return true
+		}
+	}
+	return false
+}
+
+// count method returns number of given messages logged within given time
+// window
+func (index *pipelineIndex) count(stage int, window TimeWindow) int {
+	if window.IsUnlimited() {
+		return len(index.times[stage])
+	}
+
+	count := 0
+	for _, t := range index.times[stage] {
+		if window.containsNano(t) {
+			count++
+		}
+	}
+	return count
+}
+
+// tracesWithin method returns all traces started within given time window
+func (index *pipelineIndex) tracesWithin(window TimeWindow) []*PipelineTrace {
+	if window.IsUnlimited() {
+		return index.traces
+	}
+
+	traces := []*PipelineTrace{}
+	for _, trace := range index.traces {
+		if window.containsNano(trace.started) {
+			traces = append(traces, trace)
+		}
+	}
+	return traces
+}
+
+// pipelineReader reads log entries referenced from the index
+type pipelineReader struct {
+	*logReader
+}
+
+func (index *pipelineIndex) open() (pipelineReader, error) {
+	reader, err := openLogReader(index.filename)
+	return pipelineReader{reader}, err
+}
+
+// entry method reads and parses log entry stored at given location
+func (reader pipelineReader) entry(location int64) (*PipelineLogEntry, error) {
+	line, err := reader.line(location)
+	if err != nil {
+		return nil, err
+	}
+	entry, err := parsePipelineLogEntry(line)
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+func getIncompletePipelineTraces(traces []*PipelineTrace) []*PipelineTrace {
+	incomplete := []*PipelineTrace{}
+
+	for _, trace := range traces {
+		if trace.MissingStep() != "" {
+			incomplete = append(incomplete, trace)
+		}
+	}
+	return incomplete
+}
+
+func printPipelineTrace(colorizer aurora.Aurora, i int, trace *PipelineTrace) {
+	e := strconv.Itoa(i)
+	fmt.Printf("%5s  %s  %s  missing: %s", colorizer.Blue(e), colorizer.Gray(8, trace.Started), trace.ID(), colorizer.Red(trace.MissingStep()))
+	if trace.interrupted {
+		fmt.Print("  ", colorizer.Red("interrupted by container restart"))
+	}
+	fmt.Println()
+}
+
+func printPipelineTraces(colorizer aurora.Aurora, index *pipelineIndex, window TimeWindow) error {
+	traces := index.tracesWithin(window)
+	incomplete := getIncompletePipelineTraces(traces)
+
+	fmt.Printf("%-18s %s\n", "Traces", colorizer.Blue(strconv.Itoa(len(traces))))
+	fmt.Printf("%-18s %s\n", "Complete traces", colorizer.Green(strconv.Itoa(len(traces)-len(incomplete))))
+	fmt.Printf("%-18s %s\n", "Incomplete traces", colorizer.Red(strconv.Itoa(len(incomplete))))
+	fmt.Println()
+
+	reader, err := index.open()
+	if err != nil {
+		return err
+	}
+	defer reader.close()
+
+	for i, trace := range incomplete {
+		printPipelineTrace(colorizer, i+1, trace)
+		err := printPipelineErrors(colorizer, reader, index, trace)
+		if err != nil {
+			return err
+		}
+	}
+	fmt.Println()
+	return nil
+}
+
+// PrintPipelineTraces function correlates CCX data pipeline log entries into
+// per-archive traces and prints all traces started within given time window
+// that are not complete
+func PrintPipelineTraces(colorizer aurora.Aurora, window TimeWindow) {
+	if pipelineStageIndex == nil {
+		fmt.Println(colorizer.Red(logsAreNotLoaded))
+		return
+	}
+	if pipelineStageIndex.entries == 0 {
+		fmt.Println(colorizer.Red(emptyLog))
+		return
+	}
+	err := printPipelineTraces(colorizer, pipelineStageIndex, window)
+	if err != nil {
+		fmt.Println(colorizer.Red(err))
+	}
+}
+
+// scan method processes one line of CCX data pipeline log file stored at
+// given location
+func (index *pipelineIndex) scan(line string, location int64) {
+	block := index.lines.scan(line, location, func(line string) error {
+		entry, err := parsePipelineLogEntry(line)
+		if err != nil {
+			return err
+		}
+		fields, err := parseLogFields(line)
+		if err != nil {
+			return err
+		}
+		index.add(&entry, fields, location)
+		return nil
+	})
+	if block != nil {
+		block.context = index.crashContext()
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2020, 2021, 2022 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package analyser
+
+import (
+	"fmt"
+	"testing"
+)
+
+// cluster that sends all archives in pipeline tests
+const testClusterID = "5d5892d3-1f74-4ccf-91af-548dfc9767aa"
+
+// sendingMessage is logged when report of the test cluster is sent
+var sendingMessage = fmt.Sprintf("Sending response to the ccx.ocp.results topic for cluster %s and org_id: 1", testClusterID)
+
+// pipelineLine function constructs CCX data pipeline log entry logged by
+// given pod at given second
+func pipelineLine(pod string, second int, message string) string {
+	return fmt.Sprintf(`{"levelname":"INFO","asctime":"2022-03-01 10:00:%02d,000","message":%q,"pod":%q}`, second, message, pod)
+}
+
+// archiveLines function constructs all entries logged by given pod during
+// processing of archive with given URL sent by the test cluster
+func archiveLines(pod string, second int, url string) []string {
+	return []string{
+		pipelineLine(pod, second, "JSON schema validated"),
+		pipelineLine(pod, second, "Downloading "+url),
+		pipelineLine(pod, second, "Saved "+url),
+		pipelineLine(pod, second, sendingMessage),
+		pipelineLine(pod, second, "Message has been sent successfully"),
+	}
+}
+
+func TestPipelineTracesOfOneCluster(t *testing.T) {
+	lines := []string{}
+	lines = append(lines, archiveLines("pipeline-1", 0, "https://s3.example.com/archive-1")...)
+	lines = append(lines, archiveLines("pipeline-1", 1, "https://s3.example.com/archive-2")...)
+
+	// archives processed by two pods at the same time
+	third := archiveLines("pipeline-1", 2, "https://s3.example.com/archive-3")
+	fourth := archiveLines("pipeline-2", 2, "https://s3.example.com/archive-4")
+	for i := range third {
+		lines = append(lines, third[i], fourth[i])
+	}
+
+	index, err := readPipelineLogFile(writeLines(t, "pipeline.log", lines...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(index.traces) != 4 {
+		t.Fatalf("expected 4 traces, got %d", len(index.traces))
+	}
+	for i, trace := range index.traces {
+		url := fmt.Sprintf("https://s3.example.com/archive-%d", i+1)
+		if trace.URL != url {
+			t.Errorf("trace %d: expected archive %s, got %s", i, url, trace.URL)
+		}
+		if trace.ClusterID != testClusterID || trace.Organization != 1 {
+			t.Errorf("trace %d: expected cluster %s of organization 1, got %s of %d", i, testClusterID, trace.ClusterID, trace.Organization)
+		}
+		if missing := trace.MissingStep(); missing != "" {
+			t.Errorf("trace %d of %s: unexpected missing step '%s'", i, trace.URL, missing)
+		}
+	}
+}
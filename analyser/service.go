@@ -0,0 +1,404 @@
+// Copyright 2020, 2021, 2022 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package analyser
+
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/ccx-data-pipeline-monitor/packages/analyser/service.html
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/logrusorgru/aurora"
+
+	"github.com/RedHatInsights/ccx-data-pipeline-monitor/config"
+)
+
+// Messages
+const (
+	unknownService = "Unknown service"
+	noFunnel       = "No funnel is configured for service"
+)
+
+// minimal width of the first column of service statistic
+const serviceStatisticWidth = 12
+
+// genericService contains definition of service analysed by generic
+// analyser and index of its loaded logs. Funnel is nil when no funnel
+// stages are configured for the service.
+type genericService struct {
+	config config.ServiceConfig
+	funnel *funnel
+	index  *serviceIndex
+}
+
+// genericServices contains all registered services sorted by name
+var genericServices []*genericService
+
+// findService function returns registered service with given name, or nil
+// when no such service is registered
+func findService(name string) *genericService {
+	for _, service := range genericServices {
+		if service.config.Name == name {
+			return service
+		}
+	}
+	return nil
+}
+
+// RegisterServices function registers services that are not analysed by
+// dedicated analysers, so their logs can be analysed by generic analyser.
+// Funnels of these services are read from configuration; funnel is
+// optional, but stages used in its transitions need key fields.
+func RegisterServices(services []config.ServiceConfig) error {
+	registered := []*genericService{}
+	for _, service := range services {
+		if config.IsBuiltinService(service.Name) {
+			continue
+		}
+		configured, err := config.ReadFunnelConfig(service.Name)
+		if err != nil {
+			return err
+		}
+		var f *funnel
+		if len(configured) > 0 {
+			f, err = newFunnel(configured)
+			if err == nil {
+				err = f.checkKeys()
+			}
+			if err != nil {
+				return fmt.Errorf("funnel of service '%s': %v", service.Name, err)
+			}
+		}
+		registered = append(registered, &genericService{config: service, funnel: f})
+	}
+	genericServices = registered
+	return nil
+}
+
+// genericServicesLoaded function checks whether logs of any service
+// analysed by generic analyser are loaded
+func genericServicesLoaded() bool {
+	for _, service := range genericServices {
+		if service.index != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// IsGenericService function checks whether logs of given service are
+// analysed by generic analyser
+func IsGenericService(name string) bool {
+	return findService(name) != nil
+}
+
+// format method returns format used to merge logs of the service
+func (service *genericService) format() logFormat {
+	schema := service.config.Schema
+	return logFormat{
+		timeOf: func(line string) time.Time {
+			fields, err := parseLogFields(line)
+			if err != nil {
+				return time.Time{}
+			}
+			return entryTime(schema, fields)
+		},
+		restartMarker: func(pod string, t time.Time) string {
+			return marshalMarker(map[string]string{
+				schema.Level:   entryLevelWarning,
+				schema.Time:    t.UTC().Format(schema.TimeFormat),
+				schema.Message: containerRestarted,
+			})
+		},
+	}
+}
+
+// readLogFile method reads and indexes log file of the service
+func (service *genericService) readLogFile() error {
+	index := newServiceIndex(service, service.config.LogFile)
+	err := scanLogFile(service.config.LogFile, index.scan)
+	if err != nil {
+		return err
+	}
+	service.index = index
+	return nil
+}
+
+// MergeServiceLogFiles function merges logs of given service retrieved from
+// all replicas into one file ordered by time. Logs of previous container
+// instances are terminated by restart marker.
+func MergeServiceLogFiles(name string, sources []LogSource, output string) error {
+	service := findService(name)
+	if service == nil {
+		return fmt.Errorf("%s %s", unknownService, name)
+	}
+	_, err := mergeLogFiles(sources, output, service.format(), false)
+	return err
+}
+
+// ReadServiceLogFiles function reads log file of given service. When log
+// files are given, they are merged into the log file of the service first
+// and number of skipped duplicate lines is returned too.
+func ReadServiceLogFiles(name string, filenames ...string) (entries, duplicates int, err error) {
+	service := findService(name)
+	if service == nil {
+		return 0, 0, fmt.Errorf("%s %s", unknownService, name)
+	}
+	if len(filenames) > 0 {
+		duplicates, err = loadLogFiles(filenames, service.config.LogFile, service.format())
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+	err = service.readLogFile()
+	if err != nil {
+		return 0, duplicates, err
+	}
+	return service.index.entries, duplicates, nil
+}
+
+// ServiceParseProblems function returns number of malformed and plain text
+// lines found in loaded logs of given service
+func ServiceParseProblems(name string) (malformed, text int) {
+	service := findService(name)
+	if service == nil || service.index == nil {
+		return 0, 0
+	}
+	return service.index.lines.problems()
+}
+
+// ServiceFunnelStages function returns names of funnel stages of given
+// service, no stages are returned when no funnel is configured
+func ServiceFunnelStages(name string) []string {
+	service := findService(name)
+	if service == nil || service.funnel == nil {
+		return nil
+	}
+	stages := make([]string, len(service.funnel.stages))
+	for i := range service.funnel.stages {
+		stages[i] = service.funnel.stages[i].name
+	}
+	return stages
+}
+
+// ServiceFunnelTransitions function returns all transitions between stages
+// of funnel of given service that can be used to find stuck messages
+func ServiceFunnelTransitions(name string) []FunnelTransition {
+	service := findService(name)
+	if service == nil || service.funnel == nil {
+		return nil
+	}
+	return service.funnel.describeTransitions()
+}
+
+// loadedService function returns service with loaded logs. Reason is
+// printed when the service is not known or its logs are not loaded.
+func loadedService(colorizer aurora.Aurora, name string) *genericService {
+	service := findService(name)
+	switch {
+	case service == nil:
+		fmt.Println(colorizer.Red(unknownService), name)
+		return nil
+	case service.index == nil:
+		fmt.Println(colorizer.Red(logsAreNotLoaded))
+		return nil
+	case service.index.entries == 0:
+		fmt.Println(colorizer.Red(emptyLog))
+		return nil
+	}
+	return service
+}
+
+// statisticWidth method returns width of the first column of statistic
+func (index *serviceIndex) statisticWidth() int {
+	if index.funnel != nil && index.funnel.nameWidth() > serviceStatisticWidth {
+		return index.funnel.nameWidth()
+	}
+	return serviceStatisticWidth
+}
+
+// printServiceLevels function prints number of entries of each level
+// logged within given time window
+func printServiceLevels(colorizer aurora.Aurora, index *serviceIndex, window TimeWindow) {
+	levels := make([]string, 0, len(index.levels))
+	for level := range index.levels {
+		levels = append(levels, level)
+	}
+	sort.Strings(levels)
+
+	width := index.statisticWidth()
+	for _, level := range levels {
+		count := 0
+		for _, t := range index.levels[level] {
+			if window.containsNano(t) {
+				count++
+			}
+		}
+		name := level
+		if name == "" {
+			name = "no level"
+		}
+		e := colorizer.Blue(strconv.Itoa(count))
+		if isErrorLevel(index.schema, level) {
+			e = colorizer.Red(strconv.Itoa(count))
+		}
+		fmt.Printf("%-*s %s entries\n", width, name, e)
+	}
+}
+
+// printServiceStatistic function prints number of entries by level, number
+// of messages that reached each funnel stage, and container restarts
+func printServiceStatistic(colorizer aurora.Aurora, index *serviceIndex, window TimeWindow) {
+	printServiceLevels(colorizer, index, window)
+
+	width := index.statisticWidth()
+	if index.funnel != nil {
+		fmt.Println()
+		printFunnelStatistic(colorizer, &index.funnelIndex, width, window)
+	}
+
+	for _, restart := range index.restarts {
+		if window.containsNano(restart.time) {
+			when := time.Unix(0, restart.time).UTC().Format(aggregatorTimeFormat)
+			fmt.Printf("%-*s %s  %s\n", width, "Restart", colorizer.Gray(8, when), restart.pod)
+		}
+	}
+}
+
+// PrintServiceStatistic function prints statistic gathered from logs of
+// given service within given time window
+func PrintServiceStatistic(colorizer aurora.Aurora, name string, window TimeWindow) {
+	service := loadedService(colorizer, name)
+	if service == nil {
+		return
+	}
+	printServiceStatistic(colorizer, service.index, window)
+}
+
+func printServiceEntry(colorizer aurora.Aurora, i int, index *serviceIndex, item stageItem, entry *serviceEntry) {
+	e := strconv.Itoa(i)
+	fmt.Printf("%5s  %s  %s  %s", colorizer.Blue(e), colorizer.Gray(8, entry.time), colorizer.Cyan(index.funnel.formatKey(item.key)), entry.message)
+	printEntrySource(colorizer, entry.pod, entry.sourceFile)
+}
+
+// printServiceErrorsFor function prints all error entries related to the
+// message with given key
+func printServiceErrorsFor(colorizer aurora.Aurora, reader serviceReader, index *serviceIndex, key messageKey) error {
+	for _, item := range index.errorsFor(key) {
+		entry, err := reader.entry(item.location)
+		if err != nil {
+			return err
+		}
+		message := entry.error
+		if message == "" {
+			message = entry.message
+		}
+		fmt.Printf(timeAndMessageTemplate, colorizer.Gray(8, entry.time), colorizer.Red(message))
+		err = printAttachedText(colorizer, reader.logReader, &index.lines, item.location)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// printServiceStuckMessages function prints all messages that reached the
+// first stage of the transition within given time window, but did not
+// reach the second one, together with related errors
+func printServiceStuckMessages(colorizer aurora.Aurora, index *serviceIndex, transition [2]int, window TimeWindow) error {
+	reader, err := index.open()
+	if err != nil {
+		return err
+	}
+	defer reader.close()
+
+	stuck := index.stuckAfter(transition[0], transition[1], window)
+	for i, item := range stuck {
+		entry, err := reader.entry(item.location)
+		if err != nil {
+			return err
+		}
+		printServiceEntry(colorizer, i+1, index, item, entry)
+		err = printServiceErrorsFor(colorizer, reader, index, item.key)
+		if err != nil {
+			return err
+		}
+	}
+	fmt.Println()
+	return nil
+}
+
+// PrintServiceStuckMessages function prints messages of given service that
+// are stuck in the selected funnel transition within given time window
+func PrintServiceStuckMessages(colorizer aurora.Aurora, name string, window TimeWindow, transition int) {
+	service := loadedService(colorizer, name)
+	if service == nil {
+		return
+	}
+	if service.funnel == nil {
+		fmt.Println(colorizer.Red(noFunnel), name)
+		return
+	}
+	transitions := service.funnel.transitions()
+	if transition < 0 || transition >= len(transitions) {
+		fmt.Println(colorizer.Red(unknownTransition))
+		return
+	}
+	fmt.Println(colorizer.Blue(service.funnel.describe(transitions[transition])))
+	err := printServiceStuckMessages(colorizer, service.index, transitions[transition], window)
+	if err != nil {
+		fmt.Println(colorizer.Red(err))
+	}
+}
+
+// classifyServiceErrors function reads all error entries logged within
+// given time window and groups them by template
+func classifyServiceErrors(index *serviceIndex, window TimeWindow) ([]*errorClass, error) {
+	reader, err := index.open()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.close()
+
+	return index.classifyErrors(window, func(location int64) (string, error) {
+		entry, err := reader.entry(location)
+		if err != nil {
+			return "", err
+		}
+		if entry.error == "" {
+			return entry.message, nil
+		}
+		return entry.error, nil
+	})
+}
+
+// PrintServiceErrors function prints the most frequent templates of errors
+// logged by given service within given time window together with funnel
+// stages where they happened and affected organizations and clusters
+func PrintServiceErrors(colorizer aurora.Aurora, name string, window TimeWindow, top int) {
+	service := loadedService(colorizer, name)
+	if service == nil {
+		return
+	}
+	classes, err := classifyServiceErrors(service.index, window)
+	if err != nil {
+		fmt.Println(colorizer.Red(err))
+		return
+	}
+	printErrorClasses(colorizer, classes, top)
+}
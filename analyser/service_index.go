@@ -0,0 +1,169 @@
+// Copyright 2020, 2021, 2022 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package analyser
+
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/ccx-data-pipeline-monitor/packages/analyser/service_index.html
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/RedHatInsights/ccx-data-pipeline-monitor/config"
+)
+
+// serviceIndex contains aggregated information about log entries of service
+// analysed by generic analyser: times of entries by their level, messages
+// split into funnel stages, error entries indexed by message key, and
+// container restarts. Log entries are not stored in the index, they are read
+// from the log file when needed.
+type serviceIndex struct {
+	funnelIndex
+	filename string
+	entries  int
+	schema   config.LogSchema
+	levels   map[string][]int64
+	restarts []stageItem
+	lines    logLines
+}
+
+// newServiceIndex function constructs empty index for log file of given
+// service. Services without configured funnel have no stages.
+func newServiceIndex(service *genericService, filename string) *serviceIndex {
+	return &serviceIndex{
+		funnelIndex: newFunnelIndex(service.funnel),
+		filename:    filename,
+		schema:      service.config.Schema,
+		levels:      make(map[string][]int64),
+		lines:       newLogLines(),
+	}
+}
+
+// entryTime function returns time of log entry described by given schema,
+// or zero time when the entry has no valid time
+func entryTime(schema config.LogSchema, fields logFields) time.Time {
+	t, err := time.Parse(schema.TimeFormat, fields.value(schema.Time))
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// isErrorLevel function checks whether entries with given level are errors
+func isErrorLevel(schema config.LogSchema, level string) bool {
+	for _, errorLevel := range schema.ErrorLevels {
+		if strings.EqualFold(level, errorLevel) {
+			return true
+		}
+	}
+	return false
+}
+
+// add method updates the index by one log entry stored at given location.
+// Entries are classified into funnel stages when the funnel is configured;
+// stages without key fields are just counted.
+func (index *serviceIndex) add(fields logFields, location int64) {
+	index.entries++
+	level := index.intern(fields.value(index.schema.Level))
+	// organization is not known when the attribute is not a number
+	organization, _ := strconv.Atoi(fields.value(index.schema.Organization))
+	item := stageItem{
+		location:     location,
+		time:         unixNano(entryTime(index.schema, fields)),
+		organization: organization,
+		cluster:      index.intern(fields.value(index.schema.Cluster)),
+		pod:          index.intern(fields.value("pod")),
+	}
+	index.levels[level] = append(index.levels[level], item.time)
+	index.lastPod = item.pod
+	index.lastTime = item.time
+
+	if fields.value(index.schema.Message) == containerRestarted {
+		index.restarts = append(index.restarts, item)
+		delete(index.processing, item.pod)
+		return
+	}
+
+	if index.funnel != nil {
+		stage, ok := index.funnel.classify(fields)
+		if !ok {
+			stage = noStage
+		}
+		item.key = index.key(stage, fields)
+		if ok {
+			index.addItem(stage, item)
+		}
+	}
+	if isErrorLevel(index.schema, level) {
+		index.addError(item)
+	}
+}
+
+// serviceEntry represents log entry read from the file. Just fields
+// described by the log schema are used to display the entry.
+type serviceEntry struct {
+	time       string
+	message    string
+	error      string
+	pod        string
+	sourceFile string
+}
+
+// serviceReader reads log entries referenced from the index
+type serviceReader struct {
+	*logReader
+	schema config.LogSchema
+}
+
+func (index *serviceIndex) open() (serviceReader, error) {
+	reader, err := openLogReader(index.filename)
+	return serviceReader{reader, index.schema}, err
+}
+
+// entry method reads and parses log entry stored at given location
+func (reader serviceReader) entry(location int64) (*serviceEntry, error) {
+	line, err := reader.line(location)
+	if err != nil {
+		return nil, err
+	}
+	fields, err := parseLogFields(line)
+	if err != nil {
+		return nil, err
+	}
+	return &serviceEntry{
+		time:       fields.value(reader.schema.Time),
+		message:    fields.value(reader.schema.Message),
+		error:      fields.value(reader.schema.Error),
+		pod:        fields.value("pod"),
+		sourceFile: fields.value("source_file"),
+	}, nil
+}
+
+// scan method processes one line of service log file stored at given
+// location
+func (index *serviceIndex) scan(line string, location int64) {
+	block := index.lines.scan(line, location, func(line string) error {
+		fields, err := parseLogFields(line)
+		if err != nil {
+			return err
+		}
+		index.add(fields, location)
+		return nil
+	})
+	if block != nil {
+		block.context = index.crashContext()
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright 2020, 2021, 2022 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package analyser
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/RedHatInsights/ccx-data-pipeline-monitor/config"
+)
+
+// writerFunnel contains stages of service that receives requests and
+// writes reports into database
+var writerFunnel = []config.FunnelStageConfig{
+	{Name: "Received", Keys: []string{"request"}, Match: []config.MatchRule{{Field: "message", Value: "Request received"}}},
+	{Name: "Written", After: "Received", Keys: []string{"request"}, Match: []config.MatchRule{{Field: "message", Value: "Report written"}}},
+}
+
+// writerSchema describes zerolog logs of writer service
+var writerSchema = config.LogSchema{
+	Time:         "time",
+	TimeFormat:   time.RFC3339Nano,
+	Level:        "level",
+	Message:      "message",
+	Error:        "error",
+	ErrorLevels:  []string{"error"},
+	Organization: "organization",
+	Cluster:      "cluster",
+}
+
+// newWriterIndex function constructs index of writer service logs
+func newWriterIndex(t *testing.T) *serviceIndex {
+	f, err := newFunnel(writerFunnel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := &genericService{
+		config: config.ServiceConfig{Name: "writer", Schema: writerSchema},
+		funnel: f,
+	}
+	return newServiceIndex(service, "writer.log")
+}
+
+// addServiceEntry function adds log entry with given fields into the index
+func addServiceEntry(t *testing.T, index *serviceIndex, line string) {
+	fields, err := parseLogFields(line)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index.add(fields, int64(index.entries))
+}
+
+func TestServiceIndexErrorsFor(t *testing.T) {
+	index := newWriterIndex(t)
+	for request := 1; request <= 3; request++ {
+		addServiceEntry(t, index, fmt.Sprintf(`{"level":"info","time":"2022-03-01T10:00:00Z","message":"Request received","request":%d}`, request))
+	}
+	addServiceEntry(t, index, `{"level":"info","time":"2022-03-01T10:00:01Z","message":"Report written","request":1}`)
+	addServiceEntry(t, index, `{"level":"error","time":"2022-03-01T10:00:01Z","message":"Unable to write report","request":2}`)
+	addServiceEntry(t, index, `{"level":"error","time":"2022-03-01T10:00:02Z","message":"Database timeout","request":2}`)
+	addServiceEntry(t, index, `{"level":"error","time":"2022-03-01T10:00:02Z","message":"Unable to write report","request":3}`)
+	addServiceEntry(t, index, `{"level":"error","time":"2022-03-01T10:00:03Z","message":"Connection lost"}`)
+
+	stuck := index.stuckAfter(0, 1, TimeWindow{})
+	if len(stuck) != 2 {
+		t.Fatalf("expected 2 stuck messages, got %d", len(stuck))
+	}
+	for i, expected := range []int{2, 1} {
+		errors := index.errorsFor(stuck[i].key)
+		if len(errors) != expected {
+			t.Errorf("expected %d errors for request %s, got %d", expected, stuck[i].key.primary(), len(errors))
+		}
+		for _, item := range errors {
+			if !item.key.matches(stuck[i].key) {
+				t.Errorf("error of request %s returned for request %s", item.key.primary(), stuck[i].key.primary())
+			}
+		}
+	}
+
+	// errors without key are not related to any message
+	if errors := index.errorsFor(messageKey{}); len(errors) != 0 {
+		t.Errorf("expected no errors for empty key, got %d", len(errors))
+	}
+}
+
+func TestServiceIndexCrashContext(t *testing.T) {
+	index := newWriterIndex(t)
+	lines := []string{
+		`{"level":"info","time":"2022-03-01T10:00:00Z","message":"Request received","request":7,"organization":42,"cluster":"c1","pod":"writer-1"}`,
+		`{"level":"info","time":"2022-03-01T10:00:01Z","message":"Request received","request":8,"pod":"writer-2"}`,
+		`{"level":"info","time":"2022-03-01T10:00:02Z","message":"Flushing","pod":"writer-1"}`,
+		"panic: runtime error: invalid memory address or nil pointer dereference",
+	}
+	location := int64(0)
+	for _, line := range lines {
+		index.scan(line, location)
+		location += int64(len(line)) + 1
+	}
+
+	blocks := index.lines.blocks
+	if len(blocks) != 1 {
+		t.Fatalf("expected 1 plain text block, got %d", len(blocks))
+	}
+	context := blocks[0].context
+	if context.pod != "writer-1" {
+		t.Errorf("expected crash of pod writer-1, got %s", context.pod)
+	}
+	expected := "request 7 organization 42 cluster c1"
+	if context.processed != expected {
+		t.Errorf("expected processed message '%s', got '%s'", expected, context.processed)
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2020, 2021, 2022 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package analyser
+
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/ccx-data-pipeline-monitor/packages/analyser/time_window.html
+
+import (
+	"fmt"
+	"time"
+)
+
+// TimeWindow represents time range used to filter log entries. Zero Since
+// or Until time means that the range is not limited from that side.
+type TimeWindow struct {
+	Since time.Time
+	Until time.Time
+}
+
+// unixNano function converts time into number of nanoseconds, zero time is
+// converted into zero
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+// IsUnlimited method checks whether the window is limited at all
+func (window TimeWindow) IsUnlimited() bool {
+	return window.Since.IsZero() && window.Until.IsZero()
+}
+
+// contains method checks whether given time is within the window. Entries
+// with unknown time (zero) are included only when the window is unlimited.
+func (window TimeWindow) contains(t time.Time) bool {
+	if window.IsUnlimited() {
+		return true
+	}
+	if t.IsZero() {
+		return false
+	}
+	if !window.Since.IsZero() && t.Before(window.Since) {
+		return false
+	}
+	if !window.Until.IsZero() && t.After(window.Until) {
+		return false
+	}
+	return true
+}
+
+// containsNano method checks whether time given in nanoseconds is within
+// the window
+func (window TimeWindow) containsNano(t int64) bool {
+	if t == 0 {
+		return window.contains(time.Time{})
+	}
+	return window.contains(time.Unix(0, t))
+}
+
+// String method returns human readable representation of the window
+func (window TimeWindow) String() string {
+	const layout = "2006-01-02 15:04:05"
+	switch {
+	case window.IsUnlimited():
+		return "whole log"
+	case window.Since.IsZero():
+		return fmt.Sprintf("until %s", window.Until.UTC().Format(layout))
+	case window.Until.IsZero():
+		return fmt.Sprintf("since %s", window.Since.UTC().Format(layout))
+	}
+	return fmt.Sprintf("%s - %s", window.Since.UTC().Format(layout), window.Until.UTC().Format(layout))
+}
@@ -0,0 +1,185 @@
+// Copyright 2020, 2021, 2022 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package analyser
+
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/ccx-data-pipeline-monitor/packages/analyser/watch.html
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/logrusorgru/aurora"
+)
+
+// Number of newest stuck messages displayed for each stage in watch mode
+const newestStuckMessages = 3
+
+// ANSI sequence to move cursor to top left corner and clear the screen
+const clearScreen = "\033[H\033[2J"
+
+// watchLogStream function reads log lines from the stream, stores them into
+// the given file, and calls add callback for each line. Line locations
+// correspond to positions in the file, so the index built by add callback
+// can be used to read entries back. The redraw callback is called
+// periodically until the stream is closed or the stop channel is signalled.
+// In the latter case the stream is closed by this function.
+func watchLogStream(input io.ReadCloser, storeto string, refresh time.Duration, stop <-chan struct{},
+	add func(line string, location int64), redraw func() error) error {
+	// disable "G304 (CWE-22): Potential file inclusion via variable"
+	file, err := os.OpenFile(storeto, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600) // #nosec G304
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err := file.Close()
+		if err != nil {
+			log.Println(err)
+		}
+	}()
+
+	// index is updated and displayed concurrently
+	var mutex sync.Mutex
+	done := make(chan error, 1)
+
+	go func() {
+		_, err := scanLogStream(io.TeeReader(input, file), 0, func(line string, location int64) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			add(line, location)
+		})
+		done <- err
+	}()
+
+	ticker := time.NewTicker(refresh)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case err := <-done:
+			return err
+		case <-stop:
+			// wait for the reader to finish, so the index is not updated anymore
+			closeErr := input.Close()
+			<-done
+			return closeErr
+		case <-ticker.C:
+			mutex.Lock()
+			err := redraw()
+			mutex.Unlock()
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// newest function returns at most n last items from the list
+func newest(items []stageItem, n int) []stageItem {
+	if len(items) > n {
+		return items[len(items)-n:]
+	}
+	return items
+}
+
+func redrawAggregatorWatch(colorizer aurora.Aurora, index *aggregatorIndex) error {
+	fmt.Print(clearScreen)
+	fmt.Println(colorizer.Magenta("Aggregator logs"), colorizer.Gray(8, time.Now().Format(time.RFC3339)))
+	fmt.Println()
+	printAggregatorStatistic(colorizer, index, TimeWindow{})
+	fmt.Println()
+
+	for _, transition := range index.funnel.transitions() {
+		fmt.Println(colorizer.Blue(index.funnel.describe(transition)))
+		stuck := newest(index.stuckAfter(transition[0], transition[1], TimeWindow{}), newestStuckMessages)
+		err := printStuckItems(colorizer, index, transition[0], stuck)
+		if err != nil {
+			return err
+		}
+	}
+	fmt.Println(colorizer.Gray(8, "press Ctrl+C to stop watching"))
+	return nil
+}
+
+func redrawPipelineWatch(colorizer aurora.Aurora, index *pipelineIndex) error {
+	fmt.Print(clearScreen)
+	fmt.Println(colorizer.Magenta("Pipeline logs"), colorizer.Gray(8, time.Now().Format(time.RFC3339)))
+	fmt.Println()
+	printPipelineStatistic(colorizer, index, TimeWindow{})
+	fmt.Println()
+
+	// the trace being processed at the moment is not complete yet
+	incomplete := []*PipelineTrace{}
+	for _, trace := range getIncompletePipelineTraces(index.traces) {
+		if !index.processing(trace) {
+			incomplete = append(incomplete, trace)
+		}
+	}
+	if len(incomplete) > newestStuckMessages {
+		incomplete = incomplete[len(incomplete)-newestStuckMessages:]
+	}
+
+	reader, err := index.open()
+	if err != nil {
+		return err
+	}
+	defer reader.close()
+
+	fmt.Println(colorizer.Blue("Newest incomplete traces"))
+	for i, trace := range incomplete {
+		printPipelineTrace(colorizer, i+1, trace)
+		err := printPipelineErrors(colorizer, reader, index, trace)
+		if err != nil {
+			return err
+		}
+	}
+	fmt.Println()
+	fmt.Println(colorizer.Gray(8, "press Ctrl+C to stop watching"))
+	return nil
+}
+
+// WatchAggregatorLogs function reads aggregator logs from the stream, stores
+// them into file, and periodically displays funnel statistic and newest
+// stuck messages. Logs collected so far are available for other analysis
+// commands when watching is stopped.
+func WatchAggregatorLogs(colorizer aurora.Aurora, input io.ReadCloser, storeto string, refresh time.Duration, stop <-chan struct{}) error {
+	index := newAggregatorIndex(storeto)
+	aggregatorStageIndex = index
+
+	return watchLogStream(input, storeto, refresh, stop,
+		index.scan,
+		func() error {
+			return redrawAggregatorWatch(colorizer, index)
+		})
+}
+
+// WatchPipelineLogs function reads CCX data pipeline logs from the stream,
+// stores them into file, and periodically displays statistic and newest
+// incomplete traces. Logs collected so far are available for other analysis
+// commands when watching is stopped.
+func WatchPipelineLogs(colorizer aurora.Aurora, input io.ReadCloser, storeto string, refresh time.Duration, stop <-chan struct{}) error {
+	index := newPipelineIndex(storeto)
+	pipelineStageIndex = index
+
+	return watchLogStream(input, storeto, refresh, stop,
+		index.scan,
+		func() error {
+			return redrawPipelineWatch(colorizer, index)
+		})
+}
@@ -0,0 +1,171 @@
+// Copyright 2020, 2021, 2022 Red Hat, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package analyser
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// consumedLine function returns aggregator log line for consumed message
+func consumedLine(offset int) string {
+	return fmt.Sprintf(`{"level":"info","time":%q,"message":"Consumed","topic":"ccx.ocp.results","offset":%d,"partition":0}`+"\n",
+		time.Now().UTC().Format(aggregatorTimeFormat), offset)
+}
+
+// waitForEntries function waits until the index displayed by redraw
+// callback contains given number of entries
+func waitForEntries(t *testing.T, updates <-chan int, expected int) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case entries := <-updates:
+			if entries == expected {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("index has not been updated to %d entries", expected)
+		}
+	}
+}
+
+func TestWatchMergedLogStreams(t *testing.T) {
+	storeto := filepath.Join(t.TempDir(), "aggregator.log")
+	reader1, writer1 := io.Pipe()
+	reader2, writer2 := io.Pipe()
+	input := MergeLogStreams([]LogStream{
+		{Pod: "aggregator-1", Stream: reader1},
+		{Pod: "aggregator-2", Stream: reader2},
+	})
+
+	index := newAggregatorIndex(storeto)
+	updates := make(chan int, 1)
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- watchLogStream(input, storeto, 5*time.Millisecond, stop, index.scan, func() error {
+			select {
+			case updates <- index.entries:
+			default:
+			}
+			return nil
+		})
+	}()
+
+	// the index is updated with each followed line
+	for i, writer := range []*io.PipeWriter{writer1, writer2, writer1} {
+		_, err := io.WriteString(writer, consumedLine(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		waitForEntries(t, updates, i+1)
+	}
+
+	close(stop)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("watching has not been stopped")
+	}
+
+	// pod streams are closed when watching is stopped
+	for _, writer := range []*io.PipeWriter{writer1, writer2} {
+		_, err := io.WriteString(writer, consumedLine(3))
+		if err != io.ErrClosedPipe {
+			t.Errorf("expected closed pod stream, got %v", err)
+		}
+	}
+
+	content, err := os.ReadFile(storeto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	expected := []string{"aggregator-1", "aggregator-2", "aggregator-1"}
+	if len(lines) != len(expected) {
+		t.Fatalf("expected %d stored lines, got %d", len(expected), len(lines))
+	}
+	for i, pod := range expected {
+		if !strings.HasPrefix(lines[i], `{"pod":"`+pod+`",`) {
+			t.Errorf("line %d is not tagged by pod %s: %s", i+1, pod, lines[i])
+		}
+	}
+}
+
+func TestMergeLogStreamsEnd(t *testing.T) {
+	input := MergeLogStreams([]LogStream{
+		{Pod: "aggregator-1", Stream: io.NopCloser(strings.NewReader("first\nsecond"))},
+		{Pod: "aggregator-2", Stream: io.NopCloser(strings.NewReader("third\n"))},
+	})
+	defer input.Close()
+
+	// merged stream ends when all pod streams end; non-JSON lines are not tagged
+	content, err := io.ReadAll(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 merged lines, got %q", lines)
+	}
+	// lines from one pod keep their order
+	first, second := strings.Index(string(content), "first"), strings.Index(string(content), "second")
+	if first < 0 || second < first {
+		t.Errorf("lines from one pod are not in order: %q", content)
+	}
+}
+
+// failingStream is a pod stream that fails after the first line
+type failingStream struct {
+	io.Reader
+}
+
+func (failingStream) Close() error {
+	return nil
+}
+
+func TestMergeLogStreamsError(t *testing.T) {
+	failure := fmt.Errorf("connection reset")
+	input := MergeLogStreams([]LogStream{
+		{Pod: "aggregator-1", Stream: failingStream{io.MultiReader(strings.NewReader("first\n"), &errorReader{failure})}},
+	})
+	defer input.Close()
+
+	content, err := io.ReadAll(input)
+	if err == nil || !strings.Contains(err.Error(), "aggregator-1: connection reset") {
+		t.Errorf("expected error of followed pod, got %v", err)
+	}
+	if string(content) != "first\n" {
+		t.Errorf("unexpected content %q", content)
+	}
+}
+
+// errorReader always fails with given error
+type errorReader struct {
+	err error
+}
+
+func (reader *errorReader) Read([]byte) (int, error) {
+	return 0, reader.err
+}
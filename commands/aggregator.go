@@ -21,41 +21,132 @@ package commands
 
 import (
 	"fmt"
-
-	"github.com/c-bata/go-prompt"
+	"strconv"
+	"strings"
 
 	"github.com/RedHatInsights/ccx-data-pipeline-monitor/analyser"
 )
 
 // DisplayAggregatorStatistic function displays statistic about logs taken from aggregator pods
-func DisplayAggregatorStatistic() {
+func DisplayAggregatorStatistic(param string) {
+	window, ok := timeWindowFromParam(param)
+	if !ok {
+		return
+	}
+
 	fmt.Println(colorizer.Magenta("Aggregator statistic"))
-	analyser.PrintAggregatorStatistic(colorizer)
+	analyser.PrintAggregatorStatistic(colorizer, window)
 }
 
 // DisplayAggregatorLogs function displays selected types of logs, for example consumed messages that were not read etc.
-func DisplayAggregatorLogs() {
+func DisplayAggregatorLogs(param string) {
+	window, ok := timeWindowFromParam(param)
+	if !ok {
+		return
+	}
+
 	fmt.Println(colorizer.Magenta("Aggregator logs"))
-	fmt.Println(colorizer.Cyan("1."), "consumed but not read")
-	fmt.Println(colorizer.Cyan("2."), "read but not whitelisted")
-	fmt.Println(colorizer.Cyan("3."), "whitelisted but not marshalled")
-	fmt.Println(colorizer.Cyan("4."), "marshalled but not checked")
-	fmt.Println(colorizer.Cyan("5."), "checked but not stored")
-	fmt.Println()
-
-	which := prompt.Input("selection: ", NoOpCompleter)
-	switch which {
-	case "1":
-		analyser.PrintAggregatorConsumedNotReadMessages(colorizer)
-	case "2":
-		analyser.PrintAggregatorConsumedNotWhitelisted(colorizer)
-	case "3":
-		analyser.PrintAggregatorWhitelistedNotMarshalled(colorizer)
-	case "4":
-		analyser.PrintAggregatorMarshalledNotChecked(colorizer)
-	case "5":
-		analyser.PrintAggregatorCheckedNotStored(colorizer)
-	default:
-		fmt.Println(colorizer.Red("wrong input, skipping"))
+	transition, ok := selectFunnelTransition(analyser.AggregatorFunnelTransitions())
+	if !ok {
+		return
+	}
+	analyser.PrintAggregatorStuckMessages(colorizer, window, transition)
+}
+
+// parseBreakdownOptions function separates breakdown options from the time
+// window parameter
+func parseBreakdownOptions(param string) (analyser.BreakdownOptions, string, error) {
+	options := analyser.BreakdownOptions{
+		SortBy: analyser.SortByOrganization,
+	}
+	rest := []string{}
+	words := strings.Fields(param)
+
+	for i := 0; i < len(words); i++ {
+		switch words[i] {
+		case "--clusters":
+			options.Clusters = true
+		case "--org":
+			if i+1 >= len(words) {
+				return options, "", fmt.Errorf("missing value for '%s'", words[i])
+			}
+			i++
+			organization, err := strconv.Atoi(words[i])
+			if err != nil || organization <= 0 {
+				return options, "", fmt.Errorf("invalid organization ID '%s'", words[i])
+			}
+			options.Organization = organization
+		case "--sort":
+			if i+1 >= len(words) {
+				return options, "", fmt.Errorf("missing value for '%s'", words[i])
+			}
+			i++
+			switch words[i] {
+			case analyser.SortByOrganization, analyser.SortByLoss, analyser.SortByConsumed:
+				options.SortBy = words[i]
+			default:
+				return options, "", fmt.Errorf("unknown sort order '%s', use org, loss, or consumed", words[i])
+			}
+		default:
+			rest = append(rest, words[i])
+		}
+	}
+	return options, strings.Join(rest, " "), nil
+}
+
+// DisplayAggregatorBreakdown function displays aggregator funnel statistic for each organization or cluster
+func DisplayAggregatorBreakdown(param string) {
+	options, param, err := parseBreakdownOptions(param)
+	if err != nil {
+		fmt.Println(colorizer.Red(err))
+		return
+	}
+	window, ok := timeWindowFromParam(param)
+	if !ok {
+		return
+	}
+
+	fmt.Println(colorizer.Magenta("Aggregator breakdown"))
+	analyser.PrintAggregatorBreakdown(colorizer, window, options)
+}
+
+// parseTopOption function separates --top option from the time window
+// parameter
+func parseTopOption(param string) (int, string, error) {
+	top := analyser.DefaultTopErrors
+	rest := []string{}
+	words := strings.Fields(param)
+
+	for i := 0; i < len(words); i++ {
+		if words[i] != "--top" {
+			rest = append(rest, words[i])
+			continue
+		}
+		if i+1 >= len(words) {
+			return 0, "", fmt.Errorf("missing value for '%s'", words[i])
+		}
+		i++
+		value, err := strconv.Atoi(words[i])
+		if err != nil || value <= 0 {
+			return 0, "", fmt.Errorf("invalid number of templates '%s'", words[i])
+		}
+		top = value
+	}
+	return top, strings.Join(rest, " "), nil
+}
+
+// DisplayAggregatorErrors function displays the most frequent aggregator errors normalized into templates
+func DisplayAggregatorErrors(param string) {
+	top, param, err := parseTopOption(param)
+	if err != nil {
+		fmt.Println(colorizer.Red(err))
+		return
+	}
+	window, ok := timeWindowFromParam(param)
+	if !ok {
+		return
 	}
+
+	fmt.Println(colorizer.Magenta("Aggregator errors"))
+	analyser.PrintAggregatorErrors(colorizer, window, top)
 }
@@ -0,0 +1,506 @@
+/*
+Copyright © 2020 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/ccx-data-pipeline-monitor/packages/commands/bundle.html
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/RedHatInsights/ccx-data-pipeline-monitor/analyser"
+	"github.com/RedHatInsights/ccx-data-pipeline-monitor/oc"
+)
+
+// Bundle format
+const (
+	bundleVersion      = 1
+	bundleManifestName = "manifest.json"
+)
+
+// serviceLogFiles function returns names of log files of all registered
+// services in the order the services are registered
+func serviceLogFiles() []string {
+	filenames := make([]string, len(services))
+	for i := range services {
+		filenames[i] = services[i].LogFile
+	}
+	return filenames
+}
+
+// logFetch contains information about the last retrieval of logs of one
+// service
+type logFetch struct {
+	Time    time.Time
+	Options oc.LogOptions
+	Pods    []oc.Pod
+}
+
+// fetchedLogs contains the last retrieval of logs for each service
+var fetchedLogs = make(map[string]logFetch)
+
+// rememberFetch function remembers retrieval of logs of given service, so
+// it can be described in bundle manifest
+func rememberFetch(service string, options oc.LogOptions, pods []oc.Pod, now time.Time) {
+	fetchedLogs[service] = logFetch{
+		Time:    now,
+		Options: options,
+		Pods:    pods,
+	}
+}
+
+// forgetFetch function forgets origin of logs of given service, for example
+// when the logs are replaced by logs loaded from other files
+func forgetFetch(service string) {
+	delete(fetchedLogs, service)
+	if importedBundle.manifest == nil {
+		return
+	}
+	services := []bundleService{}
+	for _, imported := range importedBundle.manifest.Services {
+		if imported.Name != service {
+			services = append(services, imported)
+		}
+	}
+	importedBundle.manifest.Services = services
+}
+
+// bundleWindow describes time window of retrieved logs. Since is zero when
+// the whole log has been retrieved, Until is the time of retrieval.
+type bundleWindow struct {
+	Since      time.Time `json:"since"`
+	Until      time.Time `json:"until"`
+	TailLines  int       `json:"tail_lines,omitempty"`
+	LimitBytes int64     `json:"limit_bytes,omitempty"`
+	Previous   bool      `json:"previous,omitempty"`
+}
+
+// bundleService describes logs of one service stored in bundle. Window and
+// pods are not known for logs that have not been retrieved by this
+// monitor instance.
+type bundleService struct {
+	Name   string        `json:"name"`
+	File   string        `json:"file"`
+	Size   int64         `json:"size"`
+	Window *bundleWindow `json:"window,omitempty"`
+	Pods   []oc.Pod      `json:"pods,omitempty"`
+}
+
+// bundleManifest is stored in each bundle and describes its content
+type bundleManifest struct {
+	Version  int             `json:"version"`
+	Created  time.Time       `json:"created"`
+	Project  string          `json:"project"`
+	Services []bundleService `json:"services"`
+}
+
+// importedBundle contains name and manifest of the last imported bundle
+var importedBundle struct {
+	filename string
+	manifest *bundleManifest
+}
+
+// importedService function returns description of service logs from the
+// last imported bundle, or nil when the logs have not been imported
+func importedService(service string) *bundleService {
+	if importedBundle.manifest == nil {
+		return nil
+	}
+	for i := range importedBundle.manifest.Services {
+		if importedBundle.manifest.Services[i].Name == service {
+			return &importedBundle.manifest.Services[i]
+		}
+	}
+	return nil
+}
+
+// fetchWindow function converts options used to retrieve logs into time
+// window stored in bundle manifest
+func fetchWindow(fetch logFetch) *bundleWindow {
+	window := bundleWindow{
+		Since:      fetch.Options.SinceTime,
+		Until:      fetch.Time,
+		TailLines:  fetch.Options.TailLines,
+		LimitBytes: fetch.Options.LimitBytes,
+		Previous:   fetch.Options.Previous,
+	}
+	if fetch.Options.Since != 0 {
+		window.Since = fetch.Time.Add(-fetch.Options.Since)
+	}
+	return &window
+}
+
+// bundleServices function describes log files available for export
+func bundleServices() ([]bundleService, error) {
+	described := []bundleService{}
+	for _, registered := range services {
+		service, filename := registered.Name, registered.LogFile
+		info, err := os.Stat(filename)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		entry := bundleService{
+			Name: service,
+			File: filename,
+			Size: info.Size(),
+		}
+		fetch, found := fetchedLogs[service]
+		if found {
+			entry.Window = fetchWindow(fetch)
+			entry.Pods = fetch.Pods
+		} else if imported := importedService(service); imported != nil {
+			entry.Window = imported.Window
+			entry.Pods = imported.Pods
+		}
+		described = append(described, entry)
+	}
+	if len(described) == 0 {
+		return nil, errors.New("there are no logs to export, use 'get aggregator', 'get pipeline' or 'get service' first")
+	}
+	return described, nil
+}
+
+// addBundleFile function copies file into bundle
+func addBundleFile(archive *tar.Writer, filename string, size int64) error {
+	// disable "G304 (CWE-22): Potential file inclusion via variable"
+	file, err := os.Open(filename) // #nosec G304
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	err = archive.WriteHeader(&tar.Header{
+		Name:    filename,
+		Mode:    0o600,
+		Size:    size,
+		ModTime: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	// the file might grow in the meantime, so just the described part is
+	// copied
+	_, err = io.CopyN(archive, file, size)
+	return err
+}
+
+// writeBundle function stores manifest and all described log files into
+// gzipped tar archive. Manifest is always the first file in the archive.
+func writeBundle(filename string, manifest *bundleManifest) error {
+	content, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// disable "G304 (CWE-22): Potential file inclusion via variable"
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600) // #nosec G304
+	if err != nil {
+		return err
+	}
+	compressed := gzip.NewWriter(file)
+	archive := tar.NewWriter(compressed)
+
+	err = archive.WriteHeader(&tar.Header{
+		Name:    bundleManifestName,
+		Mode:    0o600,
+		Size:    int64(len(content)),
+		ModTime: manifest.Created,
+	})
+	if err == nil {
+		_, err = archive.Write(content)
+	}
+	for _, service := range manifest.Services {
+		if err != nil {
+			break
+		}
+		err = addBundleFile(archive, service.File, service.Size)
+	}
+
+	// all writers need to be closed to flush data
+	for _, closer := range []io.Closer{archive, compressed, file} {
+		closeErr := closer.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// bundleFileAllowed function checks whether file from bundle can be
+// imported. Just manifest and known log files are accepted, so no other
+// file in working directory can be overwritten.
+func bundleFileAllowed(name string) bool {
+	if name == bundleManifestName {
+		return true
+	}
+	for _, filename := range serviceLogFiles() {
+		if name == filename {
+			return true
+		}
+	}
+	return false
+}
+
+// importedFileName function returns name of temporary file used to import
+// log file; the log file is replaced after the whole bundle is read
+func importedFileName(filename string) string {
+	return filename + ".import"
+}
+
+// readBundle function reads manifest from bundle and extracts all log
+// files described in manifest into temporary files
+func readBundle(filename string) (*bundleManifest, error) {
+	// disable "G304 (CWE-22): Potential file inclusion via variable"
+	file, err := os.Open(filename) // #nosec G304
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	compressed, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a bundle: %v", filename, err)
+	}
+	archive := tar.NewReader(compressed)
+
+	var manifest *bundleManifest
+	extracted := make(map[string]bool)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag != tar.TypeReg || !bundleFileAllowed(header.Name) {
+			fmt.Println(colorizer.Red("Skipping unexpected file " + header.Name))
+			continue
+		}
+
+		if header.Name == bundleManifestName {
+			manifest = &bundleManifest{}
+			err = json.NewDecoder(archive).Decode(manifest)
+			if err != nil {
+				return nil, fmt.Errorf("unable to parse bundle manifest: %v", err)
+			}
+			if manifest.Version != bundleVersion {
+				return nil, fmt.Errorf("unsupported bundle version %d", manifest.Version)
+			}
+			continue
+		}
+
+		err = extractBundleFile(archive, importedFileName(header.Name))
+		if err != nil {
+			return nil, err
+		}
+		extracted[header.Name] = true
+	}
+
+	if manifest == nil {
+		return nil, fmt.Errorf("%s does not contain %s", filename, bundleManifestName)
+	}
+	// logs of services not registered here are not imported
+	services := []bundleService{}
+	for _, service := range manifest.Services {
+		if findServiceConfig(service.Name) == nil {
+			fmt.Println(colorizer.Red("Skipping logs of unknown service " + service.Name))
+			continue
+		}
+		if !extracted[service.File] {
+			return nil, fmt.Errorf("bundle does not contain file %s", service.File)
+		}
+		services = append(services, service)
+	}
+	manifest.Services = services
+	return manifest, nil
+}
+
+// extractBundleFile function stores content of current file from bundle
+// into given file
+func extractBundleFile(archive io.Reader, filename string) error {
+	// disable "G304 (CWE-22): Potential file inclusion via variable"
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600) // #nosec G304
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, archive)
+	closeErr := file.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+// removeImportedFiles function removes all temporary files created during
+// import
+func removeImportedFiles() {
+	for _, filename := range serviceLogFiles() {
+		err := os.Remove(importedFileName(filename))
+		if err != nil && !os.IsNotExist(err) {
+			fmt.Println(colorizer.Red(err))
+		}
+	}
+}
+
+// formatWindow function describes time window of logs stored in bundle
+func formatWindow(window *bundleWindow) string {
+	if window == nil {
+		return "not known"
+	}
+	description := "whole log"
+	if !window.Since.IsZero() {
+		description = "from " + window.Since.Format(time.RFC3339)
+	}
+	description += " until " + window.Until.Format(time.RFC3339)
+	if window.TailLines != 0 {
+		description += fmt.Sprintf(", last %d lines", window.TailLines)
+	}
+	if window.LimitBytes != 0 {
+		description += fmt.Sprintf(", at most %d bytes", window.LimitBytes)
+	}
+	if window.Previous {
+		description += ", including previous containers"
+	}
+	return description
+}
+
+// printManifest function displays content of bundle
+func printManifest(manifest *bundleManifest) {
+	fmt.Println("Created:", manifest.Created.Format(time.RFC1123))
+	fmt.Println("Project:", manifest.Project)
+	for _, service := range manifest.Services {
+		fmt.Println()
+		fmt.Println(colorizer.Blue(service.Name), service.File, service.Size, "bytes")
+		fmt.Println("Window: ", formatWindow(service.Window))
+		for _, pod := range service.Pods {
+			fmt.Printf("Pod:     %s (%s, %d restarts)\n", pod.Name, pod.Phase, pod.Restarts)
+		}
+	}
+}
+
+// ExportBundle function stores retrieved logs, pods metadata and time
+// windows of retrieval into one gzipped tar archive, so the logs can be
+// analysed offline
+func ExportBundle(filename string) {
+	if filename == "" {
+		fmt.Println(colorizer.Red("usage: export bundle <file>"))
+		return
+	}
+	services, err := bundleServices()
+	if err != nil {
+		fmt.Println(colorizer.Red(err))
+		return
+	}
+	_, err = os.Stat(filename)
+	if err == nil && !ProceedQuestion("File "+filename+" already exists and will be overwritten") {
+		return
+	}
+
+	// logs from imported bundle are exported again with original project
+	project := clusterClient.Project()
+	if len(fetchedLogs) == 0 && importedBundle.manifest != nil {
+		project = importedBundle.manifest.Project
+	}
+
+	manifest := bundleManifest{
+		Version:  bundleVersion,
+		Created:  time.Now(),
+		Project:  project,
+		Services: services,
+	}
+	err = writeBundle(filename, &manifest)
+	if err != nil {
+		fmt.Println(colorizer.Red("\nUnable to export bundle"))
+		fmt.Println(err)
+		return
+	}
+	printManifest(&manifest)
+	fmt.Println()
+	fmt.Println(colorizer.Green("Bundle has been written into " + filename))
+}
+
+// ImportBundle function extracts logs from bundle created by export bundle
+// command into working directory and loads them
+func ImportBundle(filename string) {
+	if filename == "" {
+		fmt.Println(colorizer.Red("usage: import bundle <file>"))
+		return
+	}
+	for _, logFile := range serviceLogFiles() {
+		_, err := os.Stat(logFile)
+		if err == nil {
+			if !ProceedQuestion("Logs in working directory will be replaced by logs from bundle") {
+				return
+			}
+			break
+		}
+	}
+
+	defer removeImportedFiles()
+	manifest, err := readBundle(filename)
+	if err != nil {
+		fmt.Println(colorizer.Red("\nUnable to import bundle"))
+		fmt.Println(err)
+		return
+	}
+
+	// logs not contained in bundle must not be mixed with imported ones
+	for _, logFile := range serviceLogFiles() {
+		err := os.Remove(logFile)
+		if err != nil && !os.IsNotExist(err) {
+			fmt.Println(colorizer.Red(err))
+			return
+		}
+	}
+	for _, service := range manifest.Services {
+		err := os.Rename(importedFileName(service.File), service.File)
+		if err != nil {
+			fmt.Println(colorizer.Red(err))
+			return
+		}
+	}
+
+	importedBundle.filename = filename
+	importedBundle.manifest = manifest
+	fetchedLogs = make(map[string]logFetch)
+
+	printManifest(manifest)
+	fmt.Println()
+	fmt.Println(colorizer.Green("Bundle has been imported from " + filename))
+	LoadLogs("")
+	for _, service := range manifest.Services {
+		if analyser.IsGenericService(service.Name) {
+			loadServiceLogs(service.Name)
+		}
+	}
+}
@@ -20,25 +20,56 @@ package commands
 // https://redhatinsights.github.io/ccx-data-pipeline-monitor/packages/commands/common.html
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/c-bata/go-prompt"
 	"github.com/logrusorgru/aurora"
+
+	"github.com/RedHatInsights/ccx-data-pipeline-monitor/analyser"
+	"github.com/RedHatInsights/ccx-data-pipeline-monitor/oc"
 )
 
 var colorizer aurora.Aurora
 
+var clusterClient oc.ClusterClient
+
 // SetColorizer set the terminal colorizer
 func SetColorizer(c aurora.Aurora) {
 	colorizer = c
 }
 
+// SetClusterClient set the client used for all operations on OpenShift cluster
+func SetClusterClient(c oc.ClusterClient) {
+	clusterClient = c
+}
+
 // NoOpCompleter implements a no-op completer needed to input random data
 func NoOpCompleter(in prompt.Document) []prompt.Suggest {
 	return nil
 }
 
+// selectFunnelTransition function displays menu with given funnel
+// transitions and returns index of the selected one
+func selectFunnelTransition(transitions []analyser.FunnelTransition) (int, bool) {
+	for i, transition := range transitions {
+		fmt.Println(colorizer.Cyan(strconv.Itoa(i+1)+"."), strings.ToLower(transition.String()))
+	}
+	fmt.Println()
+
+	which := prompt.Input("selection: ", NoOpCompleter)
+	selected, err := strconv.Atoi(which)
+	if err != nil || selected < 1 || selected > len(transitions) {
+		fmt.Println(colorizer.Red("wrong input, skipping"))
+		return 0, false
+	}
+	return selected - 1, true
+}
+
 // ProceedQuestion ask user about y/n answer.
 func ProceedQuestion(question string) bool {
 	fmt.Println(colorizer.Red(question))
@@ -53,15 +84,44 @@ func ProceedQuestion(question string) bool {
 // Quit will exit from the CLI client
 func Quit() {
 	fmt.Println(colorizer.Magenta("Quitting"))
+	// token is kept in session file only
+	err := clusterClient.Logout()
+	if err != nil {
+		fmt.Println(colorizer.Red(err))
+	}
 	os.Exit(0)
 }
 
-// DisplayStatus displays current status (login, logs etc.)
-func DisplayStatus(loggedIn bool) {
+// DisplayStatus displays current status (login, logs etc.). Validity of
+// the token is checked, so expired token is reported.
+func DisplayStatus() {
+	ctx, cancel := operationContext(true)
+	defer cancel()
+
+	identity, err := clusterClient.WhoAmI(ctx)
 	fmt.Print("Logged into OpenShift: ")
-	if loggedIn {
-		fmt.Println(colorizer.Green("yes"))
-	} else {
+	switch {
+	case err == nil:
+		fmt.Println(colorizer.Green("yes"), "as", colorizer.Blue(identity.User))
+		fmt.Println("Token expires:        ", formatExpiration(identity.Expires, time.Now()))
+	case errors.Is(err, oc.ErrUnauthorized):
 		fmt.Println(colorizer.Red("no"))
+	default:
+		fmt.Println(colorizer.Red("unknown"), err)
+	}
+
+	fmt.Print("Project:               ")
+	if clusterClient.Project() != "" {
+		fmt.Println(colorizer.Blue(clusterClient.Project()))
+	} else {
+		fmt.Println(colorizer.Red("not selected"))
+	}
+
+	if sessionConfig.File != "" {
+		fmt.Println("Session file:         ", sessionConfig.File)
+	}
+
+	if importedBundle.manifest != nil {
+		fmt.Println("Imported bundle:      ", importedBundle.filename, "from project", importedBundle.manifest.Project)
 	}
 }
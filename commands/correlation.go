@@ -0,0 +1,37 @@
+/*
+Copyright © 2020 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/ccx-data-pipeline-monitor/packages/commands/correlation.html
+
+import (
+	"fmt"
+
+	"github.com/RedHatInsights/ccx-data-pipeline-monitor/analyser"
+)
+
+// DisplayReportsCorrelation function displays end-to-end tracking of reports sent by ccx-data-pipeline and stored by aggregator
+func DisplayReportsCorrelation(param string) {
+	window, ok := timeWindowFromParam(param)
+	if !ok {
+		return
+	}
+
+	fmt.Println(colorizer.Magenta("Reports correlation"))
+	analyser.PrintReportsCorrelation(colorizer, window)
+}
@@ -0,0 +1,73 @@
+/*
+Copyright © 2020 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/ccx-data-pipeline-monitor/packages/commands/find.html
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/RedHatInsights/ccx-data-pipeline-monitor/analyser"
+)
+
+var clusterIDRegexp = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// splitFirstWord function returns the first word of parameter and the rest
+func splitFirstWord(param string) (string, string) {
+	words := strings.Fields(param)
+	if len(words) == 0 {
+		return "", ""
+	}
+	return words[0], strings.Join(words[1:], " ")
+}
+
+// FindOrganization function displays all log entries for given organization
+func FindOrganization(param string) {
+	id, param := splitFirstWord(param)
+	organization, err := strconv.Atoi(id)
+	if err != nil || organization <= 0 {
+		fmt.Println(colorizer.Red("usage: find org <organization ID> [time window]"))
+		return
+	}
+	window, ok := timeWindowFromParam(param)
+	if !ok {
+		return
+	}
+
+	fmt.Println(colorizer.Magenta("Organization"), colorizer.Yellow(organization))
+	analyser.PrintOrganizationEntries(colorizer, organization, window)
+}
+
+// FindCluster function displays all log entries for given cluster
+func FindCluster(param string) {
+	cluster, param := splitFirstWord(param)
+	if !clusterIDRegexp.MatchString(cluster) {
+		fmt.Println(colorizer.Red("usage: find cluster <cluster UUID> [time window]"))
+		return
+	}
+	window, ok := timeWindowFromParam(param)
+	if !ok {
+		return
+	}
+
+	fmt.Println(colorizer.Magenta("Cluster"), colorizer.Yellow(cluster))
+	analyser.PrintClusterEntries(colorizer, cluster, window)
+}
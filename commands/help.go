@@ -28,19 +28,60 @@ func PrintHelp() {
 	fmt.Println(colorizer.Magenta("HELP:"))
 	fmt.Println()
 	fmt.Println(colorizer.Blue("OC related commands:"))
-	fmt.Println(colorizer.Yellow("login                    "), "login into OC")
+	fmt.Println(colorizer.Yellow("login                    "), "login into OC, token or 'oc login' command is entered")
+	fmt.Println(colorizer.Yellow("  --token-file <file>    "), "read token from file")
+	fmt.Println(colorizer.Yellow("  --token-env <variable> "), "read token from environment variable")
+	fmt.Println(colorizer.Yellow("logout                   "), "forget token and remove session file")
+	fmt.Println(colorizer.Yellow("use project <name>       "), "switch to another project (namespace)")
 	fmt.Println(colorizer.Yellow("get pods                 "), "get list of all pods + identify important ones")
+	fmt.Println(colorizer.Yellow("services                 "), "list configured services with their selectors, log files and funnels")
 	fmt.Println(colorizer.Yellow("get aggregator           "), "retrieve logs from aggregator pods")
 	fmt.Println(colorizer.Yellow("get pipeline             "), "retrieve logs from ccx-data-pipeline pods")
+	fmt.Println(colorizer.Yellow("get service <name>       "), "retrieve logs from pods of other configured service")
+	fmt.Println(colorizer.Yellow("  --previous             "), "retrieve logs of restarted containers too")
+	fmt.Println(colorizer.Yellow("  --since <duration>     "), "retrieve logs newer than given duration, 0 for whole log")
+	fmt.Println(colorizer.Yellow("  --since-time <time>    "), "retrieve logs newer than given time")
+	fmt.Println(colorizer.Yellow("  --tail <lines>         "), "retrieve given number of newest lines, 0 for all lines")
+	fmt.Println(colorizer.Yellow("  --limit-bytes <bytes>  "), "retrieve at most given number of bytes")
+	fmt.Println(colorizer.Yellow("watch aggregator         "), "follow aggregator logs and display funnel in real time")
+	fmt.Println(colorizer.Yellow("watch pipeline           "), "follow ccx-data-pipeline logs and display statistic in real time")
 	fmt.Println()
 	fmt.Println(colorizer.Blue("Status commands:"))
-	fmt.Println(colorizer.Yellow("status                   "), "print current status")
+	fmt.Println(colorizer.Yellow("status                   "), "print current status including user identity and token expiration")
+	fmt.Println()
+	fmt.Println(colorizer.Blue("Offline analysis:"))
+	fmt.Println(colorizer.Yellow("load logs                "), "load logs retrieved by get commands")
+	fmt.Println(colorizer.Yellow("load logs <paths>        "), "load log files, globs or directories, .gz and .zst files are decompressed")
+	fmt.Println(colorizer.Yellow("load service <name>      "), "load logs of other service, files can be given the same way as for load logs")
+	fmt.Println(colorizer.Yellow("export bundle <file>     "), "store retrieved logs, pods and time windows into tar.gz file")
+	fmt.Println(colorizer.Yellow("import bundle <file>     "), "extract logs from bundle into working directory and load them")
+	fmt.Println(colorizer.Yellow("parse report             "), "display malformed lines and plain text blocks found in loaded logs")
 	fmt.Println()
 	fmt.Println(colorizer.Blue("Analysis commands:"))
 	fmt.Println(colorizer.Yellow("aggregator logs          "), "display aggregator logs")
 	fmt.Println(colorizer.Yellow("aggregator statistic     "), "display aggregator statistic")
+	fmt.Println(colorizer.Yellow("aggregator breakdown     "), "display aggregator statistic per organization")
+	fmt.Println(colorizer.Yellow("  --clusters             "), "display statistic per cluster")
+	fmt.Println(colorizer.Yellow("  --org <id>             "), "display clusters of given organization only")
+	fmt.Println(colorizer.Yellow("  --sort <order>         "), "sort by org, loss (ratio), or consumed (messages)")
+	fmt.Println(colorizer.Yellow("aggregator errors        "), "display the most frequent error templates with stages and affected customers")
+	fmt.Println(colorizer.Yellow("  --top <n>              "), "number of templates to display, 10 by default")
 	fmt.Println(colorizer.Yellow("pipeline logs            "), "display pipeline logs")
 	fmt.Println(colorizer.Yellow("pipeline statistic       "), "display pipeline statistic")
+	fmt.Println(colorizer.Yellow("pipeline traces          "), "display incomplete per-archive traces")
+	fmt.Println(colorizer.Yellow("service logs <name>      "), "display messages of other service stuck in its funnel")
+	fmt.Println(colorizer.Yellow("service statistic <name> "), "display entries by level and funnel statistic of other service")
+	fmt.Println(colorizer.Yellow("service errors <name>    "), "display the most frequent error templates of other service")
+	fmt.Println(colorizer.Yellow("  --top <n>              "), "number of templates to display, 10 by default")
+	fmt.Println(colorizer.Yellow("correlate reports        "), "track reports from pipeline to aggregator storage")
+	fmt.Println(colorizer.Yellow("incidents                "), "display panics and tracebacks grouped by exception and top frame")
+	fmt.Println(colorizer.Yellow("find org <id>            "), "display all log entries for organization")
+	fmt.Println(colorizer.Yellow("find cluster <uuid>      "), "display all log entries for cluster")
+	fmt.Println()
+	fmt.Println("All analysis commands accept optional time window, for example:")
+	fmt.Println(colorizer.Yellow("  aggregator statistic last 30m"))
+	fmt.Println(colorizer.Yellow("  pipeline traces --since 2h --until 1h"))
+	fmt.Println(colorizer.Yellow("  correlate reports --since 2022-03-01 10:00 --until 2022-03-01 11:00"))
 	fmt.Println()
 	fmt.Println(colorizer.Blue("Other commands:"))
 	fmt.Println(colorizer.Yellow("version                  "), "print version information")
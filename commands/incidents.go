@@ -0,0 +1,37 @@
+/*
+Copyright © 2020 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/ccx-data-pipeline-monitor/packages/commands/incidents.html
+
+import (
+	"fmt"
+
+	"github.com/RedHatInsights/ccx-data-pipeline-monitor/analyser"
+)
+
+// DisplayIncidents function displays Go panics and Python tracebacks found in logs together with messages processed before the crash
+func DisplayIncidents(param string) {
+	window, ok := timeWindowFromParam(param)
+	if !ok {
+		return
+	}
+
+	fmt.Println(colorizer.Magenta("Incidents"))
+	analyser.PrintIncidents(colorizer, window)
+}
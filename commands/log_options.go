@@ -0,0 +1,173 @@
+/*
+Copyright © 2020 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/ccx-data-pipeline-monitor/packages/commands/log_options.html
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/RedHatInsights/ccx-data-pipeline-monitor/config"
+	"github.com/RedHatInsights/ccx-data-pipeline-monitor/oc"
+)
+
+// logOptionsUsage describes all options accepted by get commands
+const logOptionsUsage = "use --previous, --since <duration>, --since-time <time>, --tail <lines>, or --limit-bytes <bytes>"
+
+// defaultLogOptions contains limits used when logs are retrieved from pods
+var defaultLogOptions oc.LogOptions
+
+// defaultSinceTime contains the since_time limit from configuration. It is
+// resolved at each retrieval, so relative time (for example 2h) does not get
+// older while the monitor is running.
+var defaultSinceTime string
+
+// SetLogDefaults set default limits used when logs are retrieved from pods
+func SetLogDefaults(cfg config.LogsConfig) error {
+	options := oc.LogOptions{
+		Since:      cfg.Since,
+		TailLines:  cfg.TailLines,
+		LimitBytes: cfg.LimitBytes,
+	}
+	// the time is parsed here just to check the configuration
+	if cfg.SinceTime != "" {
+		t, err := parseTime(cfg.SinceTime, time.Now().UTC())
+		if err != nil {
+			return err
+		}
+		options.SinceTime = t
+	}
+	err := options.Validate()
+	if err != nil {
+		return err
+	}
+	options.SinceTime = time.Time{}
+	defaultLogOptions = options
+	defaultSinceTime = cfg.SinceTime
+	return nil
+}
+
+// logDefaults function returns default limits with since_time resolved at
+// the time of retrieval
+func logDefaults() (oc.LogOptions, error) {
+	options := defaultLogOptions
+	if defaultSinceTime != "" {
+		t, err := parseTime(defaultSinceTime, time.Now().UTC())
+		if err != nil {
+			return options, err
+		}
+		options.SinceTime = t
+	}
+	return options, nil
+}
+
+// parseLogOptions function parses options of get commands. Options that are
+// not specified are taken from defaults. Zero value can be used to disable
+// default limit.
+func parseLogOptions(param string) (oc.LogOptions, error) {
+	options, err := logDefaults()
+	if err != nil {
+		return options, err
+	}
+	words := strings.Fields(param)
+
+	for i := 0; i < len(words); {
+		option := words[i]
+		i++
+		if option == "--previous" {
+			options.Previous = true
+			continue
+		}
+
+		// absolute time might consist of two words (date and time)
+		value := []string{}
+		for i < len(words) && !strings.HasPrefix(words[i], "--") {
+			value = append(value, words[i])
+			i++
+		}
+		if len(value) == 0 {
+			return options, fmt.Errorf("missing value for '%s'", option)
+		}
+		err := setLogOption(&options, option, strings.Join(value, " "))
+		if err != nil {
+			return options, err
+		}
+	}
+
+	return options, options.Validate()
+}
+
+// setLogOption function sets one option of get commands
+func setLogOption(options *oc.LogOptions, option, value string) error {
+	var err error
+
+	switch option {
+	case "--since":
+		options.SinceTime = time.Time{}
+		if value != "0" {
+			options.Since, err = parseDuration(value)
+		} else {
+			options.Since = 0
+		}
+	case "--since-time":
+		options.Since = 0
+		if value != "0" {
+			options.SinceTime, err = parseTime(value, time.Now().UTC())
+		} else {
+			options.SinceTime = time.Time{}
+		}
+	case "--tail":
+		options.TailLines, err = strconv.Atoi(value)
+		if err != nil {
+			err = fmt.Errorf("invalid number of lines '%s'", value)
+		}
+	case "--limit-bytes":
+		options.LimitBytes, err = strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			err = fmt.Errorf("invalid number of bytes '%s'", value)
+		}
+	default:
+		err = fmt.Errorf("unknown option '%s', %s", option, logOptionsUsage)
+	}
+	return err
+}
+
+// describeLogOptions function returns human readable description of limits
+// used to retrieve logs
+func describeLogOptions(options oc.LogOptions) string {
+	limits := []string{}
+	if options.Since != 0 {
+		limits = append(limits, "since "+options.Since.String())
+	}
+	if !options.SinceTime.IsZero() {
+		limits = append(limits, "since "+options.SinceTime.UTC().Format(time.RFC3339))
+	}
+	if options.TailLines != 0 {
+		limits = append(limits, "last "+strconv.Itoa(options.TailLines)+" lines")
+	}
+	if options.LimitBytes != 0 {
+		limits = append(limits, "at most "+strconv.FormatInt(options.LimitBytes, 10)+" bytes")
+	}
+	if len(limits) == 0 {
+		return "whole log"
+	}
+	return strings.Join(limits, ", ")
+}
@@ -0,0 +1,106 @@
+/*
+Copyright © 2020 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package commands
+
+import (
+	"testing"
+	"time"
+
+	"github.com/RedHatInsights/ccx-data-pipeline-monitor/config"
+)
+
+// setTestLogDefaults function sets default limits and restores the
+// original ones when the test ends
+func setTestLogDefaults(t *testing.T, cfg config.LogsConfig) {
+	options, sinceTime := defaultLogOptions, defaultSinceTime
+	t.Cleanup(func() {
+		defaultLogOptions, defaultSinceTime = options, sinceTime
+	})
+	err := SetLogDefaults(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRelativeSinceTimeResolvedAtEachRetrieval(t *testing.T) {
+	setTestLogDefaults(t, config.LogsConfig{SinceTime: "1h"})
+
+	before := time.Now().UTC()
+	first, err := parseLogOptions("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	after := time.Now().UTC()
+	if first.SinceTime.Before(before.Add(-time.Hour)) || first.SinceTime.After(after.Add(-time.Hour)) {
+		t.Errorf("since time %v is not one hour before retrieval", first.SinceTime)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	second, err := parseLogOptions("--tail 10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !second.SinceTime.After(first.SinceTime) {
+		t.Errorf("since time %v has not been resolved again, previous %v", second.SinceTime, first.SinceTime)
+	}
+}
+
+func TestAbsoluteSinceTimeDefault(t *testing.T) {
+	setTestLogDefaults(t, config.LogsConfig{SinceTime: "2022-03-01 10:00"})
+	options, err := parseLogOptions("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	if !options.SinceTime.Equal(expected) {
+		t.Errorf("expected since time %v, got %v", expected, options.SinceTime)
+	}
+
+	// command option replaces the default
+	options, err = parseLogOptions("--since 2h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !options.SinceTime.IsZero() || options.Since != 2*time.Hour {
+		t.Errorf("unexpected options %+v", options)
+	}
+}
+
+func TestLogDefaultsWithoutSince(t *testing.T) {
+	setTestLogDefaults(t, config.LogsConfig{})
+	options, err := parseLogOptions("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if describeLogOptions(options) != "whole log" {
+		t.Errorf("expected whole log by default, got %s", describeLogOptions(options))
+	}
+}
+
+func TestInvalidSinceTimeDefault(t *testing.T) {
+	options, sinceTime := defaultLogOptions, defaultSinceTime
+	defer func() {
+		defaultLogOptions, defaultSinceTime = options, sinceTime
+	}()
+	for _, cfg := range []config.LogsConfig{
+		{SinceTime: "yesterday"},
+		{Since: time.Hour, SinceTime: "1h"},
+	} {
+		if SetLogDefaults(cfg) == nil {
+			t.Errorf("expected error for %+v", cfg)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+/*
+Copyright © 2020 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/ccx-data-pipeline-monitor/packages/commands/login.html
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+
+	"github.com/RedHatInsights/ccx-data-pipeline-monitor/config"
+	"github.com/RedHatInsights/ccx-data-pipeline-monitor/oc"
+)
+
+// loginUsage describes parameters accepted by login command
+const loginUsage = "usage: login [--token-file <file> | --token-env <variable>]"
+
+// sessionConfig contains configuration of encrypted session file
+var sessionConfig config.SessionConfig
+
+// SetSessionConfig set the configuration of encrypted session file
+func SetSessionConfig(cfg config.SessionConfig) {
+	sessionConfig = cfg
+}
+
+// readTokenFile function reads token from file
+func readTokenFile(filename string) (string, error) {
+	// disable "G304 (CWE-22): Potential file inclusion via variable"
+	content, err := os.ReadFile(filename) // #nosec G304
+	if err != nil {
+		return "", err
+	}
+	token := strings.TrimSpace(string(content))
+	if token == "" {
+		return "", fmt.Errorf("file %s does not contain token", filename)
+	}
+	return token, nil
+}
+
+// readTokenEnv function reads token from environment variable
+func readTokenEnv(variable string) (string, error) {
+	token := strings.TrimSpace(os.Getenv(variable))
+	if token == "" {
+		return "", fmt.Errorf("environment variable %s is not set", variable)
+	}
+	return token, nil
+}
+
+// ReadToken function reads token from file or environment variable selected
+// by parameter of login command
+func ReadToken(param string) (string, error) {
+	parts := strings.SplitN(param, " ", 2)
+	if len(parts) != 2 || strings.TrimSpace(parts[1]) == "" {
+		return "", errors.New(loginUsage)
+	}
+	value := strings.TrimSpace(parts[1])
+
+	switch parts[0] {
+	case "--token-file":
+		return readTokenFile(value)
+	case "--token-env":
+		return readTokenEnv(value)
+	}
+	return "", errors.New(loginUsage)
+}
+
+// sessionPassphrase function returns passphrase for session file from
+// configured environment variable or asks the user to enter it
+func sessionPassphrase() (string, error) {
+	if sessionConfig.PassphraseEnv != "" {
+		passphrase := os.Getenv(sessionConfig.PassphraseEnv)
+		if passphrase != "" {
+			return passphrase, nil
+		}
+	}
+	fmt.Print("session passphrase: ")
+	passphrase, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Println()
+	return string(passphrase), err
+}
+
+// saveSession function stores login into encrypted session file when the
+// file is configured
+func saveSession(url, ocLogin string) {
+	if sessionConfig.File == "" {
+		return
+	}
+	passphrase, err := sessionPassphrase()
+	if err == nil {
+		err = oc.SaveSession(sessionConfig.File, passphrase, oc.Session{
+			URL:   url,
+			Token: oc.ParseToken(ocLogin),
+			Saved: time.Now(),
+		})
+	}
+	if err != nil {
+		fmt.Println(colorizer.Red("Unable to save session"), err)
+		return
+	}
+	fmt.Println(colorizer.Blue("Session saved into " + sessionConfig.File))
+}
+
+// restoreSession function logs into OpenShift using session stored in
+// encrypted session file, if the file exists
+func restoreSession() {
+	if sessionConfig.File == "" {
+		return
+	}
+	_, err := os.Stat(sessionConfig.File)
+	if os.IsNotExist(err) {
+		return
+	}
+
+	passphrase, err := sessionPassphrase()
+	if err != nil {
+		fmt.Println(colorizer.Red("Unable to read session passphrase"), err)
+		return
+	}
+	session, err := oc.LoadSession(sessionConfig.File, passphrase)
+	if err != nil {
+		fmt.Println(colorizer.Red("Unable to restore session"), err)
+		return
+	}
+	fmt.Println("Restoring session saved at", session.Saved.Format(time.RFC1123))
+	loginToCluster(session.URL, session.Token)
+}
+
+// InitialLogin function logs into OpenShift when the monitor starts. Token
+// from environment variable or file has priority over stored session.
+func InitialLogin(cfg config.OpenShiftConfig) {
+	token := ""
+	if cfg.TokenEnv != "" {
+		token = strings.TrimSpace(os.Getenv(cfg.TokenEnv))
+	}
+	if token == "" && cfg.TokenFile != "" {
+		var err error
+		token, err = readTokenFile(cfg.TokenFile)
+		if err != nil {
+			fmt.Println(colorizer.Red("Unable to read token"), err)
+		}
+	}
+
+	if token != "" {
+		TryToLogin(cfg.URL, token)
+		return
+	}
+	restoreSession()
+}
+
+// Logout function forgets the token and removes session file
+func Logout() {
+	err := clusterClient.Logout()
+	if err != nil {
+		fmt.Println(colorizer.Red(err))
+	}
+	if sessionConfig.File != "" {
+		err = os.Remove(sessionConfig.File)
+		if err != nil && !os.IsNotExist(err) {
+			fmt.Println(colorizer.Red(err))
+		}
+	}
+	fmt.Println(colorizer.Blue("You have been logged out"))
+}
+
+// formatExpiration function formats expiration time of the token together
+// with remaining time
+func formatExpiration(expires, now time.Time) string {
+	if expires.IsZero() {
+		return "unknown"
+	}
+	remaining := expires.Sub(now)
+	if remaining <= 0 {
+		return expires.Format(time.RFC1123) + " (expired)"
+	}
+	return expires.Format(time.RFC1123) + " (in " + remaining.Truncate(time.Minute).String() + ")"
+}
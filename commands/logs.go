@@ -21,8 +21,10 @@ package commands
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/RedHatInsights/ccx-data-pipeline-monitor/analyser"
+	"github.com/RedHatInsights/ccx-data-pipeline-monitor/config"
 )
 
 // Messages
@@ -30,29 +32,102 @@ const (
 	numberOfLogEntries = "entries"
 )
 
-func loadAggregatorLogs() {
-	fmt.Println(colorizer.Blue("Aggregator logs"))
-	entries, err := analyser.ReadAggregatorLogFiles()
+// printLoadResult function displays number of read entries and number of
+// skipped duplicate lines
+func printLoadResult(entries, duplicates int, err error) {
 	if err != nil {
 		fmt.Println(colorizer.Red(err))
+		fmt.Println()
+		return
 	}
 	fmt.Println(colorizer.Green("Success:"), "read", colorizer.Blue(entries), numberOfLogEntries)
+	if duplicates > 0 {
+		fmt.Println("Skipped", colorizer.Blue(duplicates), "duplicate lines from overlapping files")
+	}
+}
+
+// printParseProblems function displays number of lines that are not
+// regular log entries
+func printParseProblems(malformed, text int) {
+	if malformed > 0 {
+		fmt.Println("Found", colorizer.Red(malformed), "malformed lines")
+	}
+	if text > 0 {
+		fmt.Println("Found", colorizer.Yellow(text), "plain text lines attached to log entries")
+	}
+	if malformed > 0 || text > 0 {
+		fmt.Println("Use", colorizer.Yellow("parse report"), "command to see samples")
+	}
 	fmt.Println()
 }
 
-func loadPipelineLogs() {
+// printLoadedFiles function displays log files that are merged and loaded
+func printLoadedFiles(filenames []string) {
+	for _, filename := range filenames {
+		fmt.Println(colorizer.Gray(8, filename))
+	}
+}
+
+func loadAggregatorLogs(filenames ...string) {
+	fmt.Println(colorizer.Blue("Aggregator logs"))
+	printLoadedFiles(filenames)
+	printLoadResult(analyser.ReadAggregatorLogFiles(filenames...))
+	printParseProblems(analyser.AggregatorParseProblems())
+}
+
+func loadPipelineLogs(filenames ...string) {
 	fmt.Println(colorizer.Blue("CCX data pipeline logs"))
-	entries, err := analyser.ReadPipelineLogFiles()
+	printLoadedFiles(filenames)
+	printLoadResult(analyser.ReadPipelineLogFiles(filenames...))
+	printParseProblems(analyser.PipelineParseProblems())
+}
+
+// LoadLogs function loads aggregator and pipeline logs from files (stored
+// before via oc command). Other log files can be given as paths, glob
+// patterns or directories; compressed and rotated files are supported.
+// Given files are sorted by service that produced them, including other
+// configured services, and merged into files used for analysis.
+func LoadLogs(param string) {
+	fmt.Println(colorizer.Magenta("Loading logs"))
+	if param == "" {
+		loadAggregatorLogs()
+		loadPipelineLogs()
+		return
+	}
+
+	files, err := analyser.FindLogFiles(strings.Fields(param))
 	if err != nil {
 		fmt.Println(colorizer.Red(err))
+		return
+	}
+	for _, filename := range files.Unknown {
+		fmt.Println(colorizer.Red("Skipping file with unknown format"), filename)
+	}
+	if len(files.Aggregator) == 0 && len(files.Pipeline) == 0 && len(files.Services) == 0 {
+		fmt.Println(colorizer.Red("No logs of configured services have been found"))
+		return
+	}
+
+	if len(files.Aggregator) > 0 {
+		forgetFetch(config.AggregatorService)
+		loadAggregatorLogs(files.Aggregator...)
+	}
+	if len(files.Pipeline) > 0 {
+		forgetFetch(config.PipelineService)
+		loadPipelineLogs(files.Pipeline...)
+	}
+	// other services are loaded in the order they are registered
+	for _, service := range services {
+		if filenames := files.Services[service.Name]; len(filenames) > 0 {
+			forgetFetch(service.Name)
+			loadServiceLogs(service.Name, filenames...)
+		}
 	}
-	fmt.Println(colorizer.Green("Success:"), "read", colorizer.Blue(entries), numberOfLogEntries)
-	fmt.Println()
 }
 
-// LoadLogs function loads aggregator and pipeline logs from files (stored before via oc command)
-func LoadLogs() {
-	fmt.Println(colorizer.Magenta("Loading logs"))
-	loadAggregatorLogs()
-	loadPipelineLogs()
+// DisplayParseReport function displays malformed and plain text lines found
+// in loaded log files
+func DisplayParseReport() {
+	fmt.Println(colorizer.Magenta("Parse report"))
+	analyser.PrintParseReport(colorizer)
 }
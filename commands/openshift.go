@@ -20,104 +20,225 @@ package commands
 // https://redhatinsights.github.io/ccx-data-pipeline-monitor/packages/commands/openshift.html
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
-	"strings"
+	"regexp"
+	"sync"
+	"time"
 
+	"github.com/RedHatInsights/ccx-data-pipeline-monitor/analyser"
 	"github.com/RedHatInsights/ccx-data-pipeline-monitor/config"
 	"github.com/RedHatInsights/ccx-data-pipeline-monitor/oc"
 )
 
-var aggregatorPod string = ""
-var pipelinePod string = ""
+// projectNameRegexp matches valid project (namespace) names
+var projectNameRegexp = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
 
-// TryToLogin tries to login to OpenShift via oc command
-func TryToLogin(url, ocLogin string) bool {
-	stdout, stderr, err := oc.Login(url, ocLogin)
+// maxProjectNameLength is the maximum length of project (namespace) name
+const maxProjectNameLength = 63
+
+// loginToCluster function logs into OpenShift via configured cluster client
+func loginToCluster(url, ocLogin string) bool {
+	ctx, cancel := operationContext(true)
+	defer cancel()
+
+	err := clusterClient.Login(ctx, url, ocLogin)
 	if err != nil {
-		fmt.Println(colorizer.Red("\nUnable to login to OpenShift"))
-		fmt.Println(stdout)
-		fmt.Println(stderr)
+		printOperationError("Unable to login to OpenShift", err)
 		return false
 	}
 	fmt.Println(colorizer.Green("\nDone: you have been loged in to OpenShift"))
 	return true
 }
 
-// GetPods function retrieves list of pods available for given user
-func GetPods() {
-	stdout, stderr, err := oc.GetPods()
-	if err != nil {
-		fmt.Println(colorizer.Red("\nUnable to get pods"))
-		fmt.Println(stdout)
-		fmt.Println(stderr)
+// TryToLogin tries to login to OpenShift via configured cluster client and
+// stores the session when session file is configured
+func TryToLogin(url, ocLogin string) bool {
+	if !loginToCluster(url, ocLogin) {
+		return false
+	}
+	saveSession(url, ocLogin)
+	return true
+}
+
+// UseProject function selects project (namespace) used for all operations
+// on the cluster. Pods found in the previous project are forgotten.
+func UseProject(project string) {
+	if project == "" {
+		fmt.Println(colorizer.Red("usage: use project <name>"))
 		return
 	}
-	fmt.Println(colorizer.Blue("List of available pods"))
-	fmt.Println(stdout)
-	lines := strings.Split(stdout, "\n")
-
-	aggregatorPod = ""
-	pipelinePod = ""
-	for _, line := range lines {
-		if strings.HasPrefix(line, "ccx-data-pipeline") && !strings.HasPrefix(line, "ccx-data-pipeline-db") {
-			pipelinePod = strings.Fields(line)[0]
-		}
-		if strings.HasPrefix(line, "insights-results-aggregator") {
-			aggregatorPod = strings.Fields(line)[0]
-		}
+	if len(project) > maxProjectNameLength || !projectNameRegexp.MatchString(project) {
+		fmt.Println(colorizer.Red("Invalid project name " + project))
+		return
 	}
 
-	fmt.Print(colorizer.Blue("Aggregator pod: "))
-	if aggregatorPod != "" {
-		fmt.Println(aggregatorPod)
-	} else {
-		fmt.Println(colorizer.Red("not found"))
+	clusterClient.SetProject(project)
+	forgetPods()
+
+	fmt.Println(colorizer.Green("Using project " + project))
+	fmt.Println("Run 'get pods' to find pods in this project")
+}
+
+// countingWriter counts number of bytes written into underlying writer
+type countingWriter struct {
+	writer io.Writer
+	count  int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.writer.Write(p)
+	w.count += int64(n)
+	return n, err
+}
+
+// downloadLogs function retrieves logs from selected pod and stores logs in
+// file. Logs are streamed directly into the file, so they are never held in
+// memory. Size of the log file is returned.
+func downloadLogs(ctx context.Context, pod string, options oc.LogOptions, storeto string) (int64, error) {
+	// disable "G304 (CWE-22): Potential file inclusion via variable"
+	file, err := os.OpenFile(storeto, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600) // #nosec G304
+	if err != nil {
+		return 0, err
 	}
 
-	fmt.Print(colorizer.Blue("Pipeline pod:   "))
-	if pipelinePod != "" {
-		fmt.Println(pipelinePod)
-	} else {
-		fmt.Println(colorizer.Red("not found"))
+	writer := countingWriter{writer: file}
+	err = clusterClient.GetLogs(ctx, pod, options, &writer)
+
+	closeErr := file.Close()
+	if err != nil {
+		return writer.count, err
 	}
+	return writer.count, closeErr
 }
 
-// GetLogs function retrieves logs from selected pod and stores logs in file.
-func GetLogs(pod, storeto string) {
-	stdout, stderr, err := oc.GetLogs(pod)
-	if err != nil {
-		fmt.Println(colorizer.Red("\nUnable to read logs"))
-		fmt.Println(stderr)
-		return
+// podLogs contains result of reading logs from one pod
+type podLogs struct {
+	source analyser.LogSource
+	size   int64
+	err    error
+}
+
+// mergeFunction represents analyser function that merges logs from several
+// pods into one file
+type mergeFunction func(sources []analyser.LogSource, output string) error
+
+// logSources function returns all log sources for given pods. Logs of
+// previous container instance are included for restarted pods when
+// requested.
+func logSources(pods []oc.Pod, storeto string, previous bool) []analyser.LogSource {
+	sources := []analyser.LogSource{}
+	for _, pod := range pods {
+		if pod.Restarts > 0 && previous {
+			sources = append(sources, analyser.LogSource{
+				Pod:      pod.Name,
+				Filename: storeto + "." + pod.Name + ".previous",
+				Previous: true,
+			})
+		}
+		if pod.Restarts > 0 && !previous {
+			fmt.Printf("Pod %s has been restarted %d times, use --previous to read logs before restart\n", pod.Name, pod.Restarts)
+		}
+		sources = append(sources, analyser.LogSource{
+			Pod:      pod.Name,
+			Filename: storeto + "." + pod.Name,
+		})
 	}
-	fmt.Println(colorizer.Green("Logs have been read"))
-	fmt.Printf("Log file size: %d bytes\n", len(stdout))
+	return sources
+}
 
-	err = os.WriteFile(storeto, []byte(stdout), 0o600)
+// getServiceLogs function retrieves logs from all pods of given service
+// concurrently, and merges them into one file ordered by time. Logs from
+// each pod are stored into separate file first; these files are removed
+// after merge. Logs of previous container instances are stored separately
+// and their end is marked in merged file.
+func getServiceLogs(service, title, storeto string, merge mergeFunction, param string) {
+	options, err := parseLogOptions(param)
 	if err != nil {
-		fmt.Println(colorizer.Red("\nUnable to write logs"))
-		fmt.Println(err)
+		fmt.Println(colorizer.Red(err))
 		return
 	}
-	fmt.Println(colorizer.Blue("Written into " + storeto))
-}
 
-// GetAggregatorLogs function retrieves logs from aggregator pods and stores logs in file.
-func GetAggregatorLogs() {
-	if aggregatorPod == "" {
-		fmt.Println(colorizer.Red("Aggregator pod was not found"))
+	pods := servicePods[service]
+	if len(pods) == 0 {
+		fmt.Println(colorizer.Red(title + " pod was not found"))
 		return
 	}
-	GetLogs(aggregatorPod, config.AggregatorLogFileName)
 
-}
+	fmt.Println(colorizer.Gray(8, "retrieving "+describeLogOptions(options)))
+	ctx, cancel := operationContext(true)
+	defer cancel()
+
+	sources := logSources(pods, storeto, options.Previous)
+	results := make([]podLogs, len(sources))
+	var wg sync.WaitGroup
+	for i, source := range sources {
+		wg.Add(1)
+		go func(result *podLogs, source analyser.LogSource) {
+			defer wg.Done()
+			result.source = source
+			podOptions := options
+			podOptions.Previous = source.Previous
+			result.size, result.err = downloadLogs(ctx, source.Pod, podOptions, source.Filename)
+		}(&results[i], source)
+	}
+	wg.Wait()
+
+	read := []analyser.LogSource{}
+	var firstErr error
+	for _, result := range results {
+		name := result.source.Pod
+		if result.source.Previous {
+			name += " (previous)"
+		}
+		if result.err != nil {
+			fmt.Println(colorizer.Red("Unable to read logs from "+name), result.err)
+			if firstErr == nil {
+				firstErr = result.err
+			}
+		} else {
+			fmt.Printf("%-71s %d bytes\n", name, result.size)
+			read = append(read, result.source)
+		}
+	}
+	if firstErr != nil {
+		printErrorHint(firstErr)
+	}
 
-// GetPipelineLogs function retrieves logs from ccx-data-pipeline pods and stores logs in file.
-func GetPipelineLogs() {
-	if pipelinePod == "" {
-		fmt.Println(colorizer.Red("Pipeline pod was not found"))
-		return
+	// partially read logs are not merged when the operation has been stopped
+	if ctx.Err() != nil {
+		fmt.Println(colorizer.Red("\nReading logs has been stopped, no logs have been written"))
+		read = nil
+	}
+
+	if len(read) > 0 {
+		err := merge(read, storeto)
+		if err != nil {
+			fmt.Println(colorizer.Red("\nUnable to merge logs"))
+			fmt.Println(err)
+		} else {
+			rememberFetch(service, options, pods, time.Now())
+			fmt.Println(colorizer.Green("Logs have been read"))
+			fmt.Println(colorizer.Blue("Written into " + storeto))
+		}
+	}
+
+	for _, result := range results {
+		err := os.Remove(result.source.Filename)
+		if err != nil && !os.IsNotExist(err) {
+			fmt.Println(colorizer.Red(err))
+		}
 	}
-	GetLogs(pipelinePod, config.PipelineLogFileName)
+}
+
+// GetAggregatorLogs function retrieves logs from all aggregator pods and stores logs in file.
+func GetAggregatorLogs(param string) {
+	getServiceLogs(config.AggregatorService, "Aggregator", config.AggregatorLogFileName, analyser.MergeAggregatorLogFiles, param)
+}
+
+// GetPipelineLogs function retrieves logs from all ccx-data-pipeline pods and stores logs in file.
+func GetPipelineLogs(param string) {
+	getServiceLogs(config.PipelineService, "Pipeline", config.PipelineLogFileName, analyser.MergePipelineLogFiles, param)
 }
@@ -0,0 +1,91 @@
+/*
+Copyright © 2020 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/ccx-data-pipeline-monitor/packages/commands/operation.html
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/RedHatInsights/ccx-data-pipeline-monitor/oc"
+)
+
+// defaultOperationTimeout is used when no timeout is configured
+const defaultOperationTimeout = 2 * time.Minute
+
+// operationTimeout is the maximum time of one operation on the cluster
+var operationTimeout = defaultOperationTimeout
+
+// SetOperationTimeout set the maximum time of one operation on the cluster.
+// Default timeout is used for zero value.
+func SetOperationTimeout(timeout time.Duration) error {
+	if timeout < 0 {
+		return fmt.Errorf("invalid operation timeout %v", timeout)
+	}
+	if timeout == 0 {
+		timeout = defaultOperationTimeout
+	}
+	operationTimeout = timeout
+	return nil
+}
+
+// operationContext function returns context for one operation on the
+// cluster. The operation is cancelled when the user presses Ctrl+C, but the
+// application keeps running. Watching logs is not limited by timeout. The
+// returned function needs to be called when the operation is finished.
+func operationContext(withTimeout bool) (context.Context, context.CancelFunc) {
+	ctx := context.Background()
+	cancelTimeout := context.CancelFunc(func() {})
+	if withTimeout {
+		ctx, cancelTimeout = context.WithTimeout(ctx, operationTimeout)
+	}
+
+	ctx, stopInterrupt := signal.NotifyContext(ctx, os.Interrupt)
+	return ctx, func() {
+		stopInterrupt()
+		cancelTimeout()
+	}
+}
+
+// printOperationError function displays error returned by cluster client
+// together with a hint how to resolve known kinds of errors
+func printOperationError(title string, err error) {
+	fmt.Println(colorizer.Red("\n" + title))
+	fmt.Println(err)
+	printErrorHint(err)
+}
+
+// printErrorHint function displays a hint how to resolve known kinds of
+// errors returned by cluster client
+func printErrorHint(err error) {
+	switch {
+	case errors.Is(err, oc.ErrUnauthorized):
+		fmt.Println("Use 'login' command to log into OpenShift again")
+	case errors.Is(err, oc.ErrForbidden):
+		fmt.Println("Check that you have access to project " + clusterClient.Project())
+	case errors.Is(err, oc.ErrNotFound):
+		fmt.Println("Use 'get pods' command to refresh list of pods")
+	case errors.Is(err, oc.ErrTimeout):
+		fmt.Printf("Operation has not finished in %v, timeout can be changed in configuration file\n", operationTimeout)
+	}
+}
@@ -22,17 +22,42 @@ package commands
 import (
 	"fmt"
 
-	// "github.com/c-bata/go-prompt"
-
 	"github.com/RedHatInsights/ccx-data-pipeline-monitor/analyser"
 )
 
 // DisplayPipelineStatistic function displays statistic gathered from ccx-data-pipeline logs
-func DisplayPipelineStatistic() {
+func DisplayPipelineStatistic(param string) {
+	window, ok := timeWindowFromParam(param)
+	if !ok {
+		return
+	}
+
 	fmt.Println(colorizer.Magenta("Popeline statistic"))
-	analyser.PrintPipelineStatistic(colorizer)
+	analyser.PrintPipelineStatistic(colorizer, window)
 }
 
 // DisplayPipelineLogs function displays selected types of logs gathered from ccx-data-pipeline logs
-func DisplayPipelineLogs() {
+func DisplayPipelineLogs(param string) {
+	window, ok := timeWindowFromParam(param)
+	if !ok {
+		return
+	}
+
+	fmt.Println(colorizer.Magenta("Pipeline logs"))
+	transition, ok := selectFunnelTransition(analyser.PipelineFunnelTransitions())
+	if !ok {
+		return
+	}
+	analyser.PrintPipelineStuckMessages(colorizer, window, transition)
+}
+
+// DisplayPipelineTraces function displays per-archive traces gathered from ccx-data-pipeline logs that are not complete
+func DisplayPipelineTraces(param string) {
+	window, ok := timeWindowFromParam(param)
+	if !ok {
+		return
+	}
+
+	fmt.Println(colorizer.Magenta("Pipeline traces"))
+	analyser.PrintPipelineTraces(colorizer, window)
 }
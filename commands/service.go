@@ -0,0 +1,187 @@
+/*
+Copyright © 2020 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/ccx-data-pipeline-monitor/packages/commands/service.html
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/RedHatInsights/ccx-data-pipeline-monitor/analyser"
+	"github.com/RedHatInsights/ccx-data-pipeline-monitor/config"
+)
+
+// findServiceConfig function returns registered service with given name,
+// or nil when no such service is registered
+func findServiceConfig(name string) *config.ServiceConfig {
+	for i := range services {
+		if services[i].Name == name {
+			return &services[i]
+		}
+	}
+	return nil
+}
+
+// serviceFromParam function separates name of service analysed by generic
+// analyser from the rest of parameters
+func serviceFromParam(param string) (string, string, bool) {
+	words := strings.SplitN(param, " ", 2)
+	name := words[0]
+	rest := ""
+	if len(words) > 1 {
+		rest = strings.TrimSpace(words[1])
+	}
+
+	switch {
+	case name == "":
+		fmt.Println(colorizer.Red("service name is missing, use 'services' command to list services"))
+		return "", "", false
+	case config.IsBuiltinService(name):
+		fmt.Println(colorizer.Red("Use " + name + " commands to analyse logs of " + name))
+		return "", "", false
+	case !analyser.IsGenericService(name):
+		fmt.Println(colorizer.Red("Unknown service " + name))
+		return "", "", false
+	}
+	return name, rest, true
+}
+
+// ListServices function displays all registered services together with
+// their selectors, log files and funnel stages
+func ListServices() {
+	fmt.Println(colorizer.Magenta("Services"))
+	fmt.Printf("%-16s %-40s %-24s %s\n", "NAME", "SELECTOR", "LOG FILE", "FUNNEL")
+	for _, service := range services {
+		funnel := "dedicated analyser"
+		if !config.IsBuiltinService(service.Name) {
+			funnel = strings.Join(analyser.ServiceFunnelStages(service.Name), " > ")
+			if funnel == "" {
+				funnel = "not configured"
+			}
+		}
+		fmt.Printf("%-16s %-40s %-24s %s\n", service.Name, service.Selector, service.LogFile, colorizer.Gray(8, funnel))
+	}
+	fmt.Println()
+}
+
+// GetServiceLogs function retrieves logs from all pods of given service and
+// stores logs in the log file of the service
+func GetServiceLogs(param string) {
+	name, param, ok := serviceFromParam(param)
+	if !ok {
+		return
+	}
+	merge := func(sources []analyser.LogSource, output string) error {
+		return analyser.MergeServiceLogFiles(name, sources, output)
+	}
+	getServiceLogs(name, name, findServiceConfig(name).LogFile, merge, param)
+}
+
+func loadServiceLogs(name string, filenames ...string) {
+	fmt.Println(colorizer.Blue(name + " logs"))
+	printLoadedFiles(filenames)
+	printLoadResult(analyser.ReadServiceLogFiles(name, filenames...))
+	printParseProblems(analyser.ServiceParseProblems(name))
+}
+
+// LoadServiceLogs function loads logs of given service retrieved by get
+// service command. Other log files can be given as paths, glob patterns or
+// directories, they are merged into the log file of the service.
+func LoadServiceLogs(param string) {
+	name, param, ok := serviceFromParam(param)
+	if !ok {
+		return
+	}
+
+	fmt.Println(colorizer.Magenta("Loading logs"))
+	files := []string{}
+	if param != "" {
+		var err error
+		files, err = analyser.ExpandLogPaths(strings.Fields(param))
+		if err != nil {
+			fmt.Println(colorizer.Red(err))
+			return
+		}
+		forgetFetch(name)
+	}
+
+	loadServiceLogs(name, files...)
+}
+
+// DisplayServiceStatistic function displays statistic about logs taken from
+// pods of given service
+func DisplayServiceStatistic(param string) {
+	name, param, ok := serviceFromParam(param)
+	if !ok {
+		return
+	}
+	window, ok := timeWindowFromParam(param)
+	if !ok {
+		return
+	}
+
+	fmt.Println(colorizer.Magenta(name + " statistic"))
+	analyser.PrintServiceStatistic(colorizer, name, window)
+}
+
+// DisplayServiceLogs function displays messages of given service stuck in
+// selected funnel transition
+func DisplayServiceLogs(param string) {
+	name, param, ok := serviceFromParam(param)
+	if !ok {
+		return
+	}
+	window, ok := timeWindowFromParam(param)
+	if !ok {
+		return
+	}
+
+	fmt.Println(colorizer.Magenta(name + " logs"))
+	transitions := analyser.ServiceFunnelTransitions(name)
+	if len(transitions) == 0 {
+		fmt.Println(colorizer.Red("No funnel is configured for service " + name))
+		return
+	}
+	transition, ok := selectFunnelTransition(transitions)
+	if !ok {
+		return
+	}
+	analyser.PrintServiceStuckMessages(colorizer, name, window, transition)
+}
+
+// DisplayServiceErrors function displays the most frequent errors of given
+// service normalized into templates
+func DisplayServiceErrors(param string) {
+	name, param, ok := serviceFromParam(param)
+	if !ok {
+		return
+	}
+	top, param, err := parseTopOption(param)
+	if err != nil {
+		fmt.Println(colorizer.Red(err))
+		return
+	}
+	window, ok := timeWindowFromParam(param)
+	if !ok {
+		return
+	}
+
+	fmt.Println(colorizer.Magenta(name + " errors"))
+	analyser.PrintServiceErrors(colorizer, name, window, top)
+}
@@ -0,0 +1,150 @@
+/*
+Copyright © 2020 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/ccx-data-pipeline-monitor/packages/commands/services.html
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/RedHatInsights/ccx-data-pipeline-monitor/config"
+	"github.com/RedHatInsights/ccx-data-pipeline-monitor/oc"
+)
+
+// podRunning is the phase of pod with all containers started
+const podRunning = "Running"
+
+// services contains registry of all services whose pods are discovered
+var services []config.ServiceConfig
+
+// servicePods contains pods discovered for each service by 'get pods'
+var servicePods = make(map[string][]oc.Pod)
+
+// SetServices set the registry of services whose pods are discovered
+func SetServices(s []config.ServiceConfig) {
+	services = s
+}
+
+// forgetPods function forgets all pods discovered so far
+func forgetPods() {
+	servicePods = make(map[string][]oc.Pod)
+}
+
+// servicePod function returns name of pod used to read logs of given
+// service. Running pods are preferred. Empty string is returned when no pod
+// has been discovered for the service.
+func servicePod(service string) string {
+	pods := servicePods[service]
+	for _, pod := range pods {
+		if pod.Phase == podRunning {
+			return pod.Name
+		}
+	}
+	if len(pods) > 0 {
+		return pods[0].Name
+	}
+	return ""
+}
+
+// formatAge function formats pod age the same way as oc does
+func formatAge(age time.Duration) string {
+	switch {
+	case age <= 0:
+		return "unknown"
+	case age < time.Minute:
+		return strconv.Itoa(int(age.Seconds())) + "s"
+	case age < time.Hour:
+		return strconv.Itoa(int(age.Minutes())) + "m"
+	case age < 48*time.Hour:
+		return strconv.Itoa(int(age.Hours())) + "h"
+	}
+	return strconv.Itoa(int(age.Hours()/24)) + "d"
+}
+
+// discoverServicePods function finds pods for all services in the registry
+// by their label selectors. Service name is returned for each found pod.
+func discoverServicePods(ctx context.Context) (map[string]string, error) {
+	owners := make(map[string]string)
+	discovered := make(map[string][]oc.Pod)
+
+	for _, service := range services {
+		pods, err := clusterClient.GetPods(ctx, service.Selector)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", service.Name, err)
+		}
+		discovered[service.Name] = pods
+		for _, pod := range pods {
+			owners[pod.Name] = service.Name
+		}
+	}
+
+	servicePods = discovered
+	return owners, nil
+}
+
+func printPod(pod *oc.Pod, service string, now time.Time) {
+	phase := colorizer.Green(pod.Phase)
+	if pod.Phase != podRunning {
+		phase = colorizer.Red(pod.Phase)
+	}
+	restarts := colorizer.Blue(strconv.Itoa(pod.Restarts))
+	if pod.Restarts > 0 {
+		restarts = colorizer.Red(strconv.Itoa(pod.Restarts))
+	}
+	fmt.Printf("%-60s %-12s %-10s %8s %6s  %s\n", pod.Name, service, phase, restarts, formatAge(pod.Age(now)), strings.Join(pod.Containers, ","))
+}
+
+// GetPods function retrieves list of pods available for given user and
+// identifies pods of all registered services
+func GetPods() {
+	ctx, cancel := operationContext(true)
+	defer cancel()
+
+	pods, err := clusterClient.GetPods(ctx, "")
+	if err != nil {
+		printOperationError("Unable to get pods", err)
+		return
+	}
+	owners, err := discoverServicePods(ctx)
+	if err != nil {
+		printOperationError("Unable to discover service pods", err)
+		return
+	}
+
+	now := time.Now()
+	fmt.Println(colorizer.Blue("List of available pods"))
+	fmt.Printf("%-60s %-12s %-10s %8s %6s  %s\n", "NAME", "SERVICE", "PHASE", "RESTARTS", "AGE", "CONTAINERS")
+	for i := range pods {
+		printPod(&pods[i], owners[pods[i].Name], now)
+	}
+	fmt.Println()
+
+	for _, service := range services {
+		fmt.Print(colorizer.Blue(fmt.Sprintf("%-16s", service.Name+" pod:")), " ")
+		pod := servicePod(service.Name)
+		if pod != "" {
+			fmt.Println(pod)
+		} else {
+			fmt.Println(colorizer.Red("not found"))
+		}
+	}
+}
@@ -0,0 +1,147 @@
+/*
+Copyright © 2020 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/ccx-data-pipeline-monitor/packages/commands/time_window.html
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/RedHatInsights/ccx-data-pipeline-monitor/analyser"
+)
+
+// timeWindowUsage describes all supported time window parameters
+const timeWindowUsage = "use 'last <duration>' or '--since <time> --until <time>'"
+
+// Formats of absolute time accepted in time window parameters. Times
+// without timezone are treated as UTC, the same as timestamps in logs.
+var absoluteTimeFormats = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// parseDuration function parses duration like 30m or 2h. Days are supported
+// too, because logs are often kept for several days.
+func parseDuration(value string) (time.Duration, error) {
+	if strings.HasSuffix(value, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(value, "d"))
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration '%s'", value)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration '%s'", value)
+	}
+	return duration, nil
+}
+
+// parseTime function parses either absolute time, or time relative to now
+// given as duration (for example 2h means two hours ago)
+func parseTime(value string, now time.Time) (time.Time, error) {
+	for _, format := range absoluteTimeFormats {
+		t, err := time.Parse(format, value)
+		if err == nil {
+			return t, nil
+		}
+	}
+	duration, err := parseDuration(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time '%s'", value)
+	}
+	return now.Add(-duration), nil
+}
+
+// parseTimeWindow function parses time window given as command parameter.
+// Empty parameter means the whole log.
+func parseTimeWindow(param string) (analyser.TimeWindow, error) {
+	window := analyser.TimeWindow{}
+	now := time.Now().UTC()
+	words := strings.Fields(param)
+
+	if len(words) == 0 {
+		return window, nil
+	}
+
+	if words[0] == "last" {
+		if len(words) != 2 {
+			return window, errors.New(timeWindowUsage)
+		}
+		duration, err := parseDuration(words[1])
+		if err != nil {
+			return window, err
+		}
+		window.Since = now.Add(-duration)
+		return window, nil
+	}
+
+	// absolute time might consist of two words (date and time)
+	for i := 0; i < len(words); {
+		option := words[i]
+		i++
+		value := []string{}
+		for i < len(words) && !strings.HasPrefix(words[i], "--") {
+			value = append(value, words[i])
+			i++
+		}
+		if option != "--since" && option != "--until" {
+			return window, fmt.Errorf("unknown option '%s', %s", option, timeWindowUsage)
+		}
+		if len(value) == 0 {
+			return window, fmt.Errorf("missing value for '%s'", option)
+		}
+
+		t, err := parseTime(strings.Join(value, " "), now)
+		if err != nil {
+			return window, err
+		}
+
+		if option == "--since" {
+			window.Since = t
+		} else {
+			window.Until = t
+		}
+	}
+
+	if !window.Since.IsZero() && !window.Until.IsZero() && window.Until.Before(window.Since) {
+		return window, errors.New("end of time window is before its start")
+	}
+	return window, nil
+}
+
+// timeWindowFromParam function parses time window and displays it. False is
+// returned when the parameter can't be parsed.
+func timeWindowFromParam(param string) (analyser.TimeWindow, bool) {
+	window, err := parseTimeWindow(param)
+	if err != nil {
+		fmt.Println(colorizer.Red(err))
+		return window, false
+	}
+	if !window.IsUnlimited() {
+		fmt.Println(colorizer.Gray(8, "time window: "+window.String()))
+	}
+	return window, true
+}
@@ -0,0 +1,108 @@
+/*
+Copyright © 2020 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/ccx-data-pipeline-monitor/packages/commands/watch.html
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/logrusorgru/aurora"
+
+	"github.com/RedHatInsights/ccx-data-pipeline-monitor/analyser"
+	"github.com/RedHatInsights/ccx-data-pipeline-monitor/config"
+	"github.com/RedHatInsights/ccx-data-pipeline-monitor/oc"
+)
+
+// watchRefreshInterval is the time between two screen updates in watch mode
+const watchRefreshInterval = 5 * time.Second
+
+// watchFunction represents analyser function that processes followed logs
+type watchFunction func(colorizer aurora.Aurora, input io.ReadCloser, storeto string, refresh time.Duration, stop <-chan struct{}) error
+
+// followPods function starts following logs of all given pods. Streams
+// already started are closed when logs of any pod can't be followed.
+func followPods(ctx context.Context, pods []oc.Pod) ([]analyser.LogStream, error) {
+	streams := make([]analyser.LogStream, 0, len(pods))
+	for _, pod := range pods {
+		stream, err := clusterClient.FollowLogs(ctx, pod.Name)
+		if err != nil {
+			for _, started := range streams {
+				_ = started.Stream.Close()
+			}
+			return nil, fmt.Errorf("%s: %w", pod.Name, err)
+		}
+		streams = append(streams, analyser.LogStream{Pod: pod.Name, Stream: stream})
+	}
+	return streams, nil
+}
+
+// watchServiceLogs function follows logs from all pods of given service
+// and displays analysis results until the context is cancelled or logs of
+// all pods end. Logs from all pods are merged into one stream.
+func watchServiceLogs(ctx context.Context, service, title, storeto string, watch watchFunction) {
+	pods := servicePods[service]
+	if len(pods) == 0 {
+		fmt.Println(colorizer.Red(title + " pod was not found"))
+		return
+	}
+
+	streams, err := followPods(ctx, pods)
+	if err != nil {
+		printOperationError("Unable to follow logs", err)
+		return
+	}
+	input := analyser.MergeLogStreams(streams)
+
+	err = watch(colorizer, input, storeto, watchRefreshInterval, ctx.Done())
+	if err != nil {
+		fmt.Println(colorizer.Red(err))
+	}
+
+	// logs might be still followed when the stream has not been stopped
+	err = input.Close()
+	if err != nil {
+		fmt.Println(colorizer.Red(err))
+	}
+
+	fmt.Println()
+	fmt.Println(colorizer.Blue("Logs written into " + storeto))
+}
+
+// watchLogs function follows logs from all pods of given service and
+// displays analysis results until the user presses Ctrl+C or the pod logs
+// end
+func watchLogs(service, title, storeto string, watch watchFunction) {
+	// Ctrl+C stops just the watching, not the whole application
+	ctx, cancel := operationContext(false)
+	defer cancel()
+	watchServiceLogs(ctx, service, title, storeto, watch)
+}
+
+// WatchAggregatorLogs function follows logs from all aggregator pods and displays funnel statistic in real time
+func WatchAggregatorLogs() {
+	watchLogs(config.AggregatorService, "Aggregator", config.AggregatorLogFileName, analyser.WatchAggregatorLogs)
+}
+
+// WatchPipelineLogs function follows logs from all ccx-data-pipeline pods and displays statistic in real time
+func WatchPipelineLogs() {
+	watchLogs(config.PipelineService, "Pipeline", config.PipelineLogFileName, analyser.WatchPipelineLogs)
+}
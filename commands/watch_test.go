@@ -0,0 +1,210 @@
+/*
+Copyright © 2020 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/logrusorgru/aurora"
+
+	"github.com/RedHatInsights/ccx-data-pipeline-monitor/analyser"
+	"github.com/RedHatInsights/ccx-data-pipeline-monitor/config"
+	"github.com/RedHatInsights/ccx-data-pipeline-monitor/oc"
+)
+
+// stubClient is a cluster client that feeds followed logs from pipes
+type stubClient struct {
+	mutex   sync.Mutex
+	writers map[string]*io.PipeWriter
+	failing string
+}
+
+func newStubClient() *stubClient {
+	return &stubClient{writers: make(map[string]*io.PipeWriter)}
+}
+
+func (client *stubClient) Login(ctx context.Context, url, login string) error {
+	return nil
+}
+
+func (client *stubClient) Logout() error {
+	return nil
+}
+
+func (client *stubClient) WhoAmI(ctx context.Context) (oc.Identity, error) {
+	return oc.Identity{User: "tester"}, nil
+}
+
+func (client *stubClient) Project() string {
+	return "ccx-test"
+}
+
+func (client *stubClient) SetProject(project string) {
+}
+
+func (client *stubClient) GetPods(ctx context.Context, selector string) ([]oc.Pod, error) {
+	return nil, nil
+}
+
+func (client *stubClient) GetLogs(ctx context.Context, pod string, options oc.LogOptions, w io.Writer) error {
+	return nil
+}
+
+func (client *stubClient) FollowLogs(ctx context.Context, pod string) (io.ReadCloser, error) {
+	if pod == client.failing {
+		return nil, oc.ErrNotFound
+	}
+	reader, writer := io.Pipe()
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	client.writers[pod] = writer
+	return reader, nil
+}
+
+// write method writes log line into logs followed in given pod
+func (client *stubClient) write(pod, line string) error {
+	client.mutex.Lock()
+	writer := client.writers[pod]
+	client.mutex.Unlock()
+	if writer == nil {
+		return fmt.Errorf("logs of pod %s are not followed", pod)
+	}
+	_, err := io.WriteString(writer, line+"\n")
+	return err
+}
+
+// setupWatch function replaces cluster client and discovered aggregator pods
+func setupWatch(t *testing.T, pods ...string) *stubClient {
+	client := newStubClient()
+	colorizer = aurora.NewAurora(false)
+	originalClient, originalPods := clusterClient, servicePods
+	clusterClient = client
+	servicePods = map[string][]oc.Pod{config.AggregatorService: {}}
+	for _, pod := range pods {
+		servicePods[config.AggregatorService] = append(servicePods[config.AggregatorService], oc.Pod{Name: pod})
+	}
+	t.Cleanup(func() {
+		clusterClient, servicePods = originalClient, originalPods
+	})
+	return client
+}
+
+// waitForLines function waits until the stored log contains given number of
+// lines and returns them
+func waitForLines(t *testing.T, storeto string, expected int) []string {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		content, err := os.ReadFile(storeto)
+		if err == nil {
+			lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+			if len(lines) == expected && lines[0] != "" {
+				return lines
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("stored log does not contain %d lines", expected)
+	return nil
+}
+
+func TestWatchServiceLogsFollowsAllPods(t *testing.T) {
+	client := setupWatch(t, "aggregator-1", "aggregator-2")
+	storeto := filepath.Join(t.TempDir(), "aggregator.log")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		watchServiceLogs(ctx, config.AggregatorService, "Aggregator", storeto, analyser.WatchAggregatorLogs)
+	}()
+
+	// logs from all pods are processed as they arrive
+	line := `{"level":"info","time":"2022-03-01T10:00:00Z","message":"Consumed","topic":"ccx.ocp.results","offset":%d,"partition":0}`
+	for i, pod := range []string{"aggregator-1", "aggregator-2", "aggregator-1"} {
+		deadline := time.Now().Add(5 * time.Second)
+		for client.write(pod, fmt.Sprintf(line, i)) != nil {
+			if time.Now().After(deadline) {
+				t.Fatalf("logs of pod %s are not followed", pod)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		lines := waitForLines(t, storeto, i+1)
+		if !strings.Contains(lines[i], `"pod":"`+pod+`"`) {
+			t.Errorf("line %d is not tagged by pod %s: %s", i+1, pod, lines[i])
+		}
+	}
+
+	// cancelling the context stops watching and following logs of all pods
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("watching has not been stopped")
+	}
+	for _, pod := range []string{"aggregator-1", "aggregator-2"} {
+		err := client.write(pod, fmt.Sprintf(line, 3))
+		if !errors.Is(err, io.ErrClosedPipe) {
+			t.Errorf("logs of pod %s are still followed: %v", pod, err)
+		}
+	}
+}
+
+func TestWatchServiceLogsFollowError(t *testing.T) {
+	client := setupWatch(t, "aggregator-1", "aggregator-2")
+	client.failing = "aggregator-2"
+	storeto := filepath.Join(t.TempDir(), "aggregator.log")
+
+	watched := false
+	watchServiceLogs(context.Background(), config.AggregatorService, "Aggregator", storeto,
+		func(aurora.Aurora, io.ReadCloser, string, time.Duration, <-chan struct{}) error {
+			watched = true
+			return nil
+		})
+
+	if watched {
+		t.Error("logs are watched even though some pod can't be followed")
+	}
+	// logs of pods followed before the failure are not followed anymore
+	err := client.write("aggregator-1", "{}")
+	if !errors.Is(err, io.ErrClosedPipe) {
+		t.Errorf("logs of pod aggregator-1 are still followed: %v", err)
+	}
+}
+
+func TestWatchServiceLogsWithoutPods(t *testing.T) {
+	setupWatch(t)
+	watched := false
+	watchServiceLogs(context.Background(), config.AggregatorService, "Aggregator", filepath.Join(t.TempDir(), "aggregator.log"),
+		func(aurora.Aurora, io.ReadCloser, string, time.Duration, <-chan struct{}) error {
+			watched = true
+			return nil
+		})
+	if watched {
+		t.Error("logs are watched without any pod")
+	}
+}
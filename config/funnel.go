@@ -0,0 +1,140 @@
+/*
+Copyright © 2020 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/ccx-data-pipeline-monitor/packages/config/funnel.html
+
+import (
+	"fmt"
+
+	"github.com/spf13/viper"
+)
+
+// Types of rules used to match log entries
+const (
+	MatchExact  = "exact"
+	MatchPrefix = "prefix"
+	MatchRegex  = "regex"
+)
+
+// MatchRule selects log entries by value of one field. Missing fields have
+// empty value.
+type MatchRule struct {
+	Field string
+	Type  string
+	Value string
+}
+
+// FunnelStageConfig represents one stage of funnel. Log entry belongs to the
+// stage when all its match rules are satisfied. Key fields identify the
+// message processed by the service, so entries from different stages can be
+// linked together. Each stage, except the first one, follows its
+// predecessor. Optional stages are just counted, they are not required for
+// message to pass through the funnel. Correlate marks CCX data pipeline
+// stage whose entries are matched with aggregator records.
+type FunnelStageConfig struct {
+	Name      string
+	After     string
+	Keys      []string
+	Match     []MatchRule
+	Optional  bool
+	Correlate bool
+}
+
+// aggregatorStage function constructs aggregator stage that follows the
+// consume stage. Such entries need to contain owner of the report.
+func aggregatorStage(name, after, message string) FunnelStageConfig {
+	return FunnelStageConfig{
+		Name:  name,
+		After: after,
+		Keys:  []string{"topic", "partition", "offset"},
+		Match: []MatchRule{
+			{"message", MatchExact, message},
+			{"topic", MatchRegex, "."},
+			{"organization", MatchRegex, "^[1-9]"},
+			{"cluster", MatchRegex, "."},
+			{"group", MatchExact, ""},
+		},
+	}
+}
+
+// pipelineStage function constructs CCX data pipeline stage matched by
+// message prefix
+func pipelineStage(name, after, prefix string) FunnelStageConfig {
+	return FunnelStageConfig{
+		Name:  name,
+		After: after,
+		Match: []MatchRule{{"message", MatchPrefix, prefix}},
+	}
+}
+
+// optionalStage function marks the stage as optional
+func optionalStage(stage FunnelStageConfig) FunnelStageConfig {
+	stage.Optional = true
+	return stage
+}
+
+// correlatedStage function marks the stage as the one used for correlation
+func correlatedStage(stage FunnelStageConfig) FunnelStageConfig {
+	stage.Correlate = true
+	return stage
+}
+
+// defaultFunnels are used for services without configured funnel
+var defaultFunnels = map[string][]FunnelStageConfig{
+	AggregatorService: {
+		{
+			Name: "Consumed",
+			Keys: []string{"topic", "partition", "offset"},
+			Match: []MatchRule{
+				{"message", MatchExact, "Consumed"},
+				{"group", MatchRegex, "."},
+			},
+		},
+		aggregatorStage("Read", "Consumed", "Read"),
+		aggregatorStage("Whitelisted", "Read", "Organization whitelisted"),
+		aggregatorStage("Marshalled", "Whitelisted", "Marshalled"),
+		aggregatorStage("Checked", "Marshalled", "Time ok"),
+		aggregatorStage("Stored", "Checked", "Stored"),
+	},
+	PipelineService: {
+		pipelineStage("JSON schema validated", "", "JSON schema validated"),
+		optionalStage(pipelineStage("Identity schema validated", "", "Identity schema validated")),
+		pipelineStage("Downloaded", "JSON schema validated", "Downloading "),
+		pipelineStage("Saved", "Downloaded", "Saved "),
+		correlatedStage(pipelineStage("Sending start", "Saved", "Sending response to the ")),
+		pipelineStage("Sending successful", "Sending start", "Message has been sent successfully"),
+		optionalStage(pipelineStage("Context retrieved", "", "Message context: ")),
+		optionalStage(pipelineStage("Success", "", "Status: Success; ")),
+	},
+}
+
+// ReadFunnelConfig function reads funnel of given service from the
+// [[funnel.<service>]] sections. Default funnel is returned when no stage is
+// configured.
+func ReadFunnelConfig(service string) ([]FunnelStageConfig, error) {
+	var stages []FunnelStageConfig
+	err := viper.UnmarshalKey("funnel."+service, &stages)
+	if err != nil {
+		return nil, fmt.Errorf("funnel of service '%s': %v", service, err)
+	}
+	if len(stages) == 0 {
+		return defaultFunnels[service], nil
+	}
+	return stages, nil
+}
@@ -0,0 +1,50 @@
+/*
+Copyright © 2020 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/ccx-data-pipeline-monitor/packages/config/logs.html
+
+import (
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// LogsConfig represents default limits used when logs are retrieved from
+// pods. Zero values mean no limit.
+type LogsConfig struct {
+	Since      time.Duration
+	SinceTime  string
+	TailLines  int
+	LimitBytes int64
+}
+
+// ReadLogsConfig function reads default limits for retrieving logs. All
+// options are optional, so the whole section can be omitted.
+func ReadLogsConfig() LogsConfig {
+	var cfg LogsConfig
+	sub := viper.Sub("logs")
+	if sub == nil {
+		return cfg
+	}
+	cfg.Since = sub.GetDuration("since")
+	cfg.SinceTime = sub.GetString("since_time")
+	cfg.TailLines = sub.GetInt("tail")
+	cfg.LimitBytes = sub.GetInt64("limit_bytes")
+	return cfg
+}
@@ -20,13 +20,25 @@ package config
 // https://redhatinsights.github.io/ccx-data-pipeline-monitor/packages/config/openshift.html
 
 import (
+	"time"
+
 	"github.com/spf13/viper"
 )
 
-// OpenShiftConfig represents all configuration options required to get access to OpenShift via oc client
+// OpenShiftConfig represents all configuration options required to get access to OpenShift via oc client.
+// Timeout limits duration of each operation on the cluster, default timeout is used when it is not set.
+// Token used to login at start can be read from environment variable TokenEnv or from file TokenFile.
+// Certificate of API server is verified by CA bundle CAFile in addition to system certificates,
+// verification can be disabled by Insecure.
 type OpenShiftConfig struct {
-	URL     string
-	Project string
+	URL       string
+	Project   string
+	Client    string
+	Timeout   time.Duration
+	TokenEnv  string
+	TokenFile string
+	CAFile    string
+	Insecure  bool
 }
 
 // ReadOpenShiftConfig function reads configuration options required to get access to OpenShift via oc client
@@ -35,5 +47,11 @@ func ReadOpenShiftConfig() OpenShiftConfig {
 	sub := viper.Sub("openshift")
 	cfg.URL = sub.GetString("url")
 	cfg.Project = sub.GetString("project")
+	cfg.Client = sub.GetString("client")
+	cfg.Timeout = sub.GetDuration("timeout")
+	cfg.TokenEnv = sub.GetString("token_env")
+	cfg.TokenFile = sub.GetString("token_file")
+	cfg.CAFile = sub.GetString("ca_file")
+	cfg.Insecure = sub.GetBool("insecure")
 	return cfg
 }
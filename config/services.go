@@ -0,0 +1,198 @@
+/*
+Copyright © 2020 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/ccx-data-pipeline-monitor/packages/config/services.html
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Names of services whose logs are analysed by dedicated analysers. Other
+// services are analysed by generic analyser driven by their log schema and
+// funnel.
+const (
+	AggregatorService = "aggregator"
+	PipelineService   = "pipeline"
+)
+
+// LogSchema maps attributes of JSON log entries of the service to fields
+// used by generic analyser. Time format is given as Go reference time.
+// Entries with one of error levels are reported as errors; their error
+// attribute is used as error message, message attribute when the error
+// attribute is missing. Organization and cluster attributes identify owner
+// of the processed report.
+type LogSchema struct {
+	Time         string
+	TimeFormat   string
+	Level        string
+	Message      string
+	Error        string
+	ErrorLevels  []string
+	Organization string
+	Cluster      string
+}
+
+// ServiceConfig represents one service running in OpenShift. Pods of the
+// service are found by label selector, logs retrieved from pods are stored
+// into log file.
+type ServiceConfig struct {
+	Name     string
+	Selector string
+	LogFile  string
+	Schema   LogSchema
+}
+
+// defaultLogSchema describes logs produced by zerolog, that is used by CCX
+// services written in Go
+var defaultLogSchema = LogSchema{
+	Time:         "time",
+	TimeFormat:   time.RFC3339Nano,
+	Level:        "level",
+	Message:      "message",
+	Error:        "error",
+	ErrorLevels:  []string{"error", "fatal", "panic"},
+	Organization: "organization",
+	Cluster:      "cluster",
+}
+
+// defaultServices are used for builtin services that are not configured
+var defaultServices = []ServiceConfig{
+	{AggregatorService, "app=insights-results-aggregator", AggregatorLogFileName, defaultLogSchema},
+	{PipelineService, "app=ccx-data-pipeline", PipelineLogFileName, defaultLogSchema},
+}
+
+// IsBuiltinService function checks whether the service is analysed by
+// dedicated analyser
+func IsBuiltinService(name string) bool {
+	return name == AggregatorService || name == PipelineService
+}
+
+// defaultLogFile function returns name of file used to store logs of given
+// service when no file is configured
+func defaultLogFile(name string) string {
+	switch name {
+	case AggregatorService:
+		return AggregatorLogFileName
+	case PipelineService:
+		return PipelineLogFileName
+	}
+	return name + ".log"
+}
+
+// readLogSchema function reads log schema from [services.<name>.schema]
+// section. Attributes that are not configured are taken from the default
+// schema.
+func readLogSchema(sub *viper.Viper) LogSchema {
+	schema := defaultLogSchema
+	if sub == nil {
+		return schema
+	}
+	for _, attribute := range []struct {
+		key   string
+		value *string
+	}{
+		{"time", &schema.Time},
+		{"time_format", &schema.TimeFormat},
+		{"level", &schema.Level},
+		{"message", &schema.Message},
+		{"error", &schema.Error},
+		{"organization", &schema.Organization},
+		{"cluster", &schema.Cluster},
+	} {
+		if sub.IsSet(attribute.key) {
+			*attribute.value = sub.GetString(attribute.key)
+		}
+	}
+	if sub.IsSet("error_levels") {
+		schema.ErrorLevels = sub.GetStringSlice("error_levels")
+	}
+	return schema
+}
+
+// defaultService function returns default configuration of builtin
+// service, or nil for other services
+func defaultService(name string) *ServiceConfig {
+	for i := range defaultServices {
+		if defaultServices[i].Name == name {
+			service := defaultServices[i]
+			return &service
+		}
+	}
+	return nil
+}
+
+// readServiceConfig function reads configuration of one service from the
+// [services.<name>] section. Attributes of builtin services that are not
+// configured are taken from their defaults; other services need selector.
+func readServiceConfig(name string) (ServiceConfig, error) {
+	service := ServiceConfig{
+		Name:    name,
+		LogFile: defaultLogFile(name),
+		Schema:  defaultLogSchema,
+	}
+	if builtin := defaultService(name); builtin != nil {
+		service = *builtin
+	}
+
+	sub := viper.Sub("services." + name)
+	if sub != nil {
+		if selector := sub.GetString("selector"); selector != "" {
+			service.Selector = selector
+		}
+		if logFile := sub.GetString("log_file"); logFile != "" {
+			service.LogFile = logFile
+		}
+		service.Schema = readLogSchema(sub.Sub("schema"))
+	}
+	if service.Selector == "" {
+		return service, fmt.Errorf("service '%s' has no selector", name)
+	}
+	return service, nil
+}
+
+// ReadServicesConfig function reads registry of all services from the
+// [services.<name>] sections. Builtin services are always registered, their
+// defaults are used when they are not configured. Services are sorted by
+// name.
+func ReadServicesConfig() ([]ServiceConfig, error) {
+	names := []string{}
+	for name := range viper.GetStringMap("services") {
+		if !IsBuiltinService(name) {
+			names = append(names, name)
+		}
+	}
+	for _, service := range defaultServices {
+		names = append(names, service.Name)
+	}
+	sort.Strings(names)
+
+	services := make([]ServiceConfig, 0, len(names))
+	for _, name := range names {
+		service, err := readServiceConfig(name)
+		if err != nil {
+			return nil, err
+		}
+		services = append(services, service)
+	}
+	return services, nil
+}
@@ -0,0 +1,94 @@
+/*
+Copyright © 2020 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// readTestConfig function replaces configuration by given TOML content
+func readTestConfig(t *testing.T, content string) {
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	viper.SetConfigType("toml")
+	err := viper.ReadConfig(strings.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadServicesConfigDefaults(t *testing.T) {
+	readTestConfig(t, "")
+	services, err := ReadServicesConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(services) != len(defaultServices) {
+		t.Fatalf("expected %d default services, got %d", len(defaultServices), len(services))
+	}
+	for i, service := range services {
+		if service.Name != defaultServices[i].Name || service.Selector != defaultServices[i].Selector {
+			t.Errorf("unexpected service %+v", service)
+		}
+	}
+}
+
+func TestReadServicesConfigMergesBuiltinServices(t *testing.T) {
+	readTestConfig(t, `
+[services.notification]
+selector="app=ccx-notification-service"
+
+[services.aggregator]
+log_file="aggregator-prod.log"
+`)
+	services, err := ReadServicesConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []ServiceConfig{
+		{Name: AggregatorService, Selector: "app=insights-results-aggregator", LogFile: "aggregator-prod.log"},
+		{Name: "notification", Selector: "app=ccx-notification-service", LogFile: "notification.log"},
+		{Name: PipelineService, Selector: "app=ccx-data-pipeline", LogFile: PipelineLogFileName},
+	}
+	if len(services) != len(expected) {
+		t.Fatalf("expected %d services, got %+v", len(expected), services)
+	}
+	for i, service := range services {
+		if service.Name != expected[i].Name || service.Selector != expected[i].Selector || service.LogFile != expected[i].LogFile {
+			t.Errorf("expected service %+v, got %+v", expected[i], service)
+		}
+		if service.Schema.Time != defaultLogSchema.Time {
+			t.Errorf("service %s does not use default schema", service.Name)
+		}
+	}
+}
+
+func TestReadServicesConfigWithoutSelector(t *testing.T) {
+	for _, content := range []string{
+		"[services.notification]\nlog_file=\"notification.log\"\n",
+		"[services.notification]\nselector=\"\"\n",
+	} {
+		readTestConfig(t, content)
+		_, err := ReadServicesConfig()
+		if err == nil || !strings.Contains(err.Error(), "service 'notification' has no selector") {
+			t.Errorf("expected missing selector error, got %v", err)
+		}
+	}
+}
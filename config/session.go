@@ -0,0 +1,46 @@
+/*
+Copyright © 2020 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/ccx-data-pipeline-monitor/packages/config/session.html
+
+import (
+	"github.com/spf13/viper"
+)
+
+// SessionConfig represents configuration of encrypted session file that
+// keeps login between runs of the monitor. Session is not stored when File
+// is empty. Passphrase is read from environment variable PassphraseEnv or
+// entered by the user.
+type SessionConfig struct {
+	File          string
+	PassphraseEnv string
+}
+
+// ReadSessionConfig function reads configuration of session file. The
+// whole section is optional.
+func ReadSessionConfig() SessionConfig {
+	var cfg SessionConfig
+	sub := viper.Sub("session")
+	if sub == nil {
+		return cfg
+	}
+	cfg.File = sub.GetString("file")
+	cfg.PassphraseEnv = sub.GetString("passphrase_env")
+	return cfg
+}
@@ -1,13 +1,15 @@
 module github.com/RedHatInsights/ccx-data-pipeline-monitor
 
-go 1.17
+go 1.22
 
 require (
 	github.com/c-bata/go-prompt v0.2.3
 	github.com/gorilla/mux v1.8.0
+	github.com/klauspost/compress v1.18.0
 	github.com/logrusorgru/aurora v0.0.0-20200102142835-e9ef32dff381
 	github.com/spf13/viper v1.10.1
-	golang.org/x/term v0.3.0
+	golang.org/x/crypto v0.21.0
+	golang.org/x/term v0.18.0
 )
 
 require (
@@ -28,8 +30,8 @@ require (
 	github.com/spf13/jwalterweatherman v1.1.0 // indirect
 	github.com/spf13/pflag v1.0.5 // indirect
 	github.com/subosito/gotenv v1.2.0 // indirect
-	golang.org/x/sys v0.3.0 // indirect
-	golang.org/x/text v0.3.8 // indirect
+	golang.org/x/sys v0.18.0 // indirect
+	golang.org/x/text v0.14.0 // indirect
 	gopkg.in/check.v1 v1.0.0-20200902074654-038fdea0a05b // indirect
 	gopkg.in/ini.v1 v1.66.2 // indirect
 	gopkg.in/yaml.v2 v2.4.0 // indirect
@@ -34,15 +34,18 @@ import (
 	"github.com/spf13/viper"
 	"golang.org/x/term"
 
+	"github.com/RedHatInsights/ccx-data-pipeline-monitor/analyser"
 	"github.com/RedHatInsights/ccx-data-pipeline-monitor/commands"
 	"github.com/RedHatInsights/ccx-data-pipeline-monitor/config"
+	"github.com/RedHatInsights/ccx-data-pipeline-monitor/oc"
 	"github.com/RedHatInsights/ccx-data-pipeline-monitor/server"
 )
 
 var openShiftConfig config.OpenShiftConfig
 
+var servicesConfig []config.ServiceConfig
+
 var colorizer aurora.Aurora
-var loggedIn bool = false
 
 // BuildVersion contains the major.minor version of the CLI client
 var BuildVersion string = "*not set*"
@@ -54,14 +57,24 @@ func printVersion() {
 	fmt.Println(colorizer.Blue("Insights operator CLI client "), "version", colorizer.Yellow(BuildVersion), "compiled", colorizer.Yellow(BuildTime))
 }
 
-func login() {
+func login(param string) {
+	if param != "" {
+		token, err := commands.ReadToken(param)
+		if err != nil {
+			fmt.Println(colorizer.Red(err))
+			return
+		}
+		commands.TryToLogin(openShiftConfig.URL, token)
+		return
+	}
+
 	fmt.Print("login: ")
 	p, err := term.ReadPassword(0)
 	if err != nil {
 		fmt.Println(colorizer.Red("not set"))
 	} else {
 		ocLogin := string(p)
-		loggedIn = commands.TryToLogin(openShiftConfig.URL, ocLogin)
+		commands.TryToLogin(openShiftConfig.URL, ocLogin)
 	}
 }
 
@@ -74,21 +87,61 @@ var simpleCommands = []simpleCommand{
 	{"bye", commands.Quit},
 	{"exit", commands.Quit},
 	{"quit", commands.Quit},
-	{"login", login},
+	{"logout", commands.Logout},
 	{"?", commands.PrintHelp},
 	{"help", commands.PrintHelp},
 	{"version", printVersion},
 	{"license", commands.PrintLicense},
 	{"authors", commands.PrintAuthors},
-	{"status", func() { commands.DisplayStatus(loggedIn) }},
+	{"status", commands.DisplayStatus},
+	{"parse report", commands.DisplayParseReport},
 	{"get pods", commands.GetPods},
-	{"get aggregator", commands.GetAggregatorLogs},
-	{"get pipeline", commands.GetPipelineLogs},
-	{"load logs", commands.LoadLogs},
+	{"services", commands.ListServices},
+	{"watch aggregator", commands.WatchAggregatorLogs},
+	{"watch pipeline", commands.WatchPipelineLogs},
+}
+
+type commandWithParam struct {
+	prefix  string
+	handler func(string)
+}
+
+// commands that accept parameters, including optional time window
+var commandsWithParam = []commandWithParam{
 	{"aggregator logs", commands.DisplayAggregatorLogs},
 	{"aggregator statistic", commands.DisplayAggregatorStatistic},
+	{"aggregator breakdown", commands.DisplayAggregatorBreakdown},
+	{"aggregator errors", commands.DisplayAggregatorErrors},
 	{"pipeline logs", commands.DisplayPipelineLogs},
 	{"pipeline statistic", commands.DisplayPipelineStatistic},
+	{"pipeline traces", commands.DisplayPipelineTraces},
+	{"correlate reports", commands.DisplayReportsCorrelation},
+	{"incidents", commands.DisplayIncidents},
+	{"service logs", commands.DisplayServiceLogs},
+	{"service statistic", commands.DisplayServiceStatistic},
+	{"service errors", commands.DisplayServiceErrors},
+	{"find org", commands.FindOrganization},
+	{"find cluster", commands.FindCluster},
+	{"use project", commands.UseProject},
+	{"login", login},
+	{"get aggregator", commands.GetAggregatorLogs},
+	{"get pipeline", commands.GetPipelineLogs},
+	{"get service", commands.GetServiceLogs},
+	{"load logs", commands.LoadLogs},
+	{"load service", commands.LoadServiceLogs},
+	{"export bundle", commands.ExportBundle},
+	{"import bundle", commands.ImportBundle},
+}
+
+func executeCommandWithParam(t string) bool {
+	for _, command := range commandsWithParam {
+		if t == command.prefix || strings.HasPrefix(t, command.prefix+" ") {
+			param := strings.TrimSpace(strings.TrimPrefix(t, command.prefix))
+			command.handler(param)
+			return true
+		}
+	}
+	return false
 }
 
 func executeFixedCommand(t string) {
@@ -103,6 +156,9 @@ func executeFixedCommand(t string) {
 }
 
 func executor(t string) {
+	if executeCommandWithParam(t) {
+		return
+	}
 	executeFixedCommand(t)
 }
 
@@ -120,13 +176,25 @@ func completer(in prompt.Document) []prompt.Suggest {
 		{Text: "status", Description: "displays status"},
 
 		{Text: "login", Description: "provide login info"},
+		{Text: "logout", Description: "forget token and remove session file"},
 		{Text: "get pods", Description: "get list of available pods"},
 		{Text: "get aggregator", Description: "retrieve logs from aggregator pods"},
 		{Text: "get pipeline", Description: "retrieve logs from ccx-data-pipeline pods"},
+		{Text: "get service", Description: "retrieve logs from pods of other service"},
+		{Text: "services", Description: "list services and their funnels"},
+		{Text: "use", Description: "select project used for all cluster operations"},
 
 		{Text: "load", Description: "load given object or objects"},
+		{Text: "export", Description: "export logs for offline analysis"},
+		{Text: "import", Description: "import logs exported before"},
+		{Text: "watch", Description: "follow logs and display statistic in real time"},
 		{Text: "aggregator", Description: "aggregator-related commands"},
 		{Text: "pipeline", Description: "pipeline-related commands"},
+		{Text: "service", Description: "commands for other services"},
+		{Text: "correlate", Description: "cross-service correlation commands"},
+		{Text: "find", Description: "find log entries for one customer"},
+		{Text: "incidents", Description: "panics and tracebacks grouped by stack trace"},
+		{Text: "parse", Description: "malformed and plain text lines in loaded logs"},
 	}
 
 	secondWord := make(map[string][]prompt.Suggest)
@@ -136,23 +204,70 @@ func completer(in prompt.Document) []prompt.Suggest {
 		{Text: "pods", Description: "list of pods"},
 		{Text: "aggregator", Description: "get aggregator logs"},
 		{Text: "pipeline", Description: "get pipeline logs"},
+		{Text: "service", Description: "get logs of other service"},
+	}
+
+	// project selection
+	secondWord["use"] = []prompt.Suggest{
+		{Text: "project", Description: "switch to given project (namespace)"},
 	}
 
 	// loading objects
 	secondWord["load"] = []prompt.Suggest{
 		{Text: "logs", Description: "load log files"},
+		{Text: "service", Description: "load log files of other service"},
+	}
+
+	// parse problems
+	secondWord["parse"] = []prompt.Suggest{
+		{Text: "report", Description: "display malformed and plain text lines found in loaded logs"},
+	}
+
+	// offline analysis
+	secondWord["export"] = []prompt.Suggest{
+		{Text: "bundle", Description: "store logs, pods and time windows into tar.gz file"},
+	}
+	secondWord["import"] = []prompt.Suggest{
+		{Text: "bundle", Description: "extract and load logs from tar.gz file"},
+	}
+
+	// live tail
+	secondWord["watch"] = []prompt.Suggest{
+		{Text: "aggregator", Description: "follow aggregator logs"},
+		{Text: "pipeline", Description: "follow pipeline logs"},
 	}
 
 	// aggregator-related operations
 	secondWord["aggregator"] = []prompt.Suggest{
 		{Text: "logs", Description: "display aggregator logs"},
 		{Text: "statistic", Description: "display aggregator statistic"},
+		{Text: "breakdown", Description: "display aggregator statistic per organization or cluster"},
+		{Text: "errors", Description: "display the most frequent aggregator errors"},
 	}
 
 	// pipeline-related operations
 	secondWord["pipeline"] = []prompt.Suggest{
 		{Text: "logs", Description: "display pipeline logs"},
 		{Text: "statistic", Description: "display pipeline statistic"},
+		{Text: "traces", Description: "display incomplete per-archive traces"},
+	}
+
+	// operations on other services
+	secondWord["service"] = []prompt.Suggest{
+		{Text: "logs", Description: "display messages stuck in funnel"},
+		{Text: "statistic", Description: "display entries by level and funnel statistic"},
+		{Text: "errors", Description: "display the most frequent errors"},
+	}
+
+	// cross-service correlation
+	secondWord["correlate"] = []prompt.Suggest{
+		{Text: "reports", Description: "track reports from pipeline to aggregator storage"},
+	}
+
+	// customer-related queries
+	secondWord["find"] = []prompt.Suggest{
+		{Text: "org", Description: "display all log entries for organization"},
+		{Text: "cluster", Description: "display all log entries for cluster"},
 	}
 
 	emptySuggest := []prompt.Suggest{}
@@ -204,6 +319,26 @@ func startCLI() {
 	colorizer = aurora.NewAurora(*colors)
 	commands.SetColorizer(colorizer)
 
+	clusterClient, err := oc.NewClusterClient(openShiftConfig.Client, openShiftConfig.Project, oc.TLSOptions{
+		CAFile:   openShiftConfig.CAFile,
+		Insecure: openShiftConfig.Insecure,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	commands.SetClusterClient(clusterClient)
+	err = commands.SetOperationTimeout(openShiftConfig.Timeout)
+	if err != nil {
+		log.Fatal(err)
+	}
+	commands.SetServices(servicesConfig)
+	err = commands.SetLogDefaults(config.ReadLogsConfig())
+	if err != nil {
+		log.Fatal(err)
+	}
+	commands.SetSessionConfig(config.ReadSessionConfig())
+	commands.InitialLogin(openShiftConfig)
+
 	if *useCompleter {
 		p := prompt.New(executor, completer)
 		p.Run()
@@ -216,6 +351,9 @@ func startCLI() {
 			fmt.Print("> ")
 		}
 	}
+
+	// end of input: files with login info need to be removed
+	commands.Quit()
 }
 
 func startWebUI() {
@@ -240,6 +378,20 @@ func main() {
 		panic(fmt.Errorf("Fatal error config file: %s", err))
 	}
 
+	err = analyser.ReadFunnels()
+	if err != nil {
+		panic(fmt.Errorf("Fatal error in funnel configuration: %s", err))
+	}
+
+	servicesConfig, err = config.ReadServicesConfig()
+	if err != nil {
+		panic(fmt.Errorf("Fatal error in services configuration: %s", err))
+	}
+	err = analyser.RegisterServices(servicesConfig)
+	if err != nil {
+		panic(fmt.Errorf("Fatal error in services configuration: %s", err))
+	}
+
 	uiType := viper.Sub("ui").GetString("type")
 	openShiftConfig = config.ReadOpenShiftConfig()
 
@@ -0,0 +1,257 @@
+/*
+Copyright © 2020, 2021, 2022 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oc
+
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/ccx-data-pipeline-monitor/packages/oc/client.html
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Kinds of cluster clients that can be selected in configuration
+const (
+	ClientOc     = "oc"
+	ClientNative = "native"
+)
+
+// ClusterClient represents all operations performed on OpenShift cluster.
+// Operations can be performed by oc binary or directly via Kubernetes REST
+// API, so the monitor works even in containers without oc installed. All
+// operations with pods are scoped to selected project (namespace).
+//
+// All operations are stopped when provided context is cancelled or its
+// deadline expires. Errors of known kinds (see ErrUnauthorized, ErrNotFound,
+// ErrTimeout etc.) can be checked by errors.Is.
+type ClusterClient interface {
+	// Login logs into the cluster. Either bearer token or the whole
+	// 'oc login' command with --token option can be provided. The token is
+	// checked by WhoAmI call and it is never passed to other processes via
+	// command line arguments.
+	Login(ctx context.Context, url, login string) error
+
+	// Logout forgets the token and removes all files created by Login
+	Logout() error
+
+	// WhoAmI returns identity of logged in user. ErrUnauthorized is
+	// returned when the token is not valid or has expired.
+	WhoAmI(ctx context.Context) (Identity, error)
+
+	// Project returns project (namespace) used for all operations
+	Project() string
+
+	// SetProject selects project (namespace) used for all operations
+	SetProject(project string)
+
+	// GetPods returns list of pods in selected project that match given
+	// label selector. All pods are returned for empty selector.
+	GetPods(ctx context.Context, selector string) ([]Pod, error)
+
+	// GetLogs writes logs for selected pod into provided writer, so the
+	// logs are never held in memory
+	GetLogs(ctx context.Context, pod string, options LogOptions, w io.Writer) error
+
+	// FollowLogs starts reading logs for selected pod including all new
+	// log entries. The caller needs to close the returned reader when logs
+	// are no longer needed.
+	FollowLogs(ctx context.Context, pod string) (io.ReadCloser, error)
+}
+
+// LogOptions contains options for reading pod logs. When Previous is set,
+// logs of the previous (terminated) container instance are read. Zero
+// values of other options mean no limit. Since and SinceTime can't be used
+// together.
+type LogOptions struct {
+	Previous   bool
+	Since      time.Duration
+	SinceTime  time.Time
+	TailLines  int
+	LimitBytes int64
+}
+
+// Validate method checks whether the options can be used together
+func (options *LogOptions) Validate() error {
+	if options.Since != 0 && !options.SinceTime.IsZero() {
+		return errors.New("since and since-time options can't be used together")
+	}
+	if options.Since < 0 || options.TailLines < 0 || options.LimitBytes < 0 {
+		return errors.New("log limits can't be negative")
+	}
+	return nil
+}
+
+// Identity represents user logged into the cluster. Expires is zero when
+// expiration time of the token is not known or the token never expires.
+type Identity struct {
+	User    string
+	Expires time.Time
+}
+
+// tokenPrefix is the prefix of OAuth access tokens issued by OpenShift 4
+const tokenPrefix = "sha256~"
+
+// tokenObjectName function returns name of UserOAuthAccessToken object
+// that describes given token. The name is derived from token hash, so the
+// token itself is never revealed. Empty string is returned for tokens in
+// unknown format.
+func tokenObjectName(token string) string {
+	if !strings.HasPrefix(token, tokenPrefix) {
+		return ""
+	}
+	hash := sha256.Sum256([]byte(strings.TrimPrefix(token, tokenPrefix)))
+	return tokenPrefix + base64.RawURLEncoding.EncodeToString(hash[:])
+}
+
+// accessToken is the subset of UserOAuthAccessToken object that is needed
+// to compute expiration time of the token
+type accessToken struct {
+	Metadata struct {
+		CreationTimestamp time.Time `json:"creationTimestamp"`
+	} `json:"metadata"`
+	ExpiresIn int64 `json:"expiresIn"`
+}
+
+// parseTokenExpiration function parses UserOAuthAccessToken object in JSON
+// format and returns expiration time of the token. Zero time is returned
+// for tokens that never expire.
+func parseTokenExpiration(input []byte) (time.Time, error) {
+	var token accessToken
+	err := json.Unmarshal(input, &token)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unable to parse access token: %v", err)
+	}
+	if token.ExpiresIn <= 0 {
+		return time.Time{}, nil
+	}
+	return token.Metadata.CreationTimestamp.Add(time.Duration(token.ExpiresIn) * time.Second), nil
+}
+
+// Pod represents basic information about one pod. Restarts is the sum of
+// restarts of all containers in the pod.
+type Pod struct {
+	Name       string    `json:"name"`
+	Phase      string    `json:"phase"`
+	Restarts   int       `json:"restarts"`
+	Created    time.Time `json:"created"`
+	Containers []string  `json:"containers"`
+}
+
+// Age method returns time elapsed since the pod has been created
+func (pod *Pod) Age(now time.Time) time.Duration {
+	if pod.Created.IsZero() {
+		return 0
+	}
+	return now.Sub(pod.Created)
+}
+
+// podList is the subset of Kubernetes PodList returned both by REST API and
+// by 'oc get pods -o json' that is needed by the monitor
+type podList struct {
+	Items []struct {
+		Metadata struct {
+			Name              string    `json:"name"`
+			CreationTimestamp time.Time `json:"creationTimestamp"`
+		} `json:"metadata"`
+		Spec struct {
+			Containers []struct {
+				Name string `json:"name"`
+			} `json:"containers"`
+		} `json:"spec"`
+		Status struct {
+			Phase             string `json:"phase"`
+			ContainerStatuses []struct {
+				Name         string `json:"name"`
+				RestartCount int    `json:"restartCount"`
+			} `json:"containerStatuses"`
+		} `json:"status"`
+	} `json:"items"`
+}
+
+// parsePodList function parses list of pods in JSON format
+func parsePodList(input []byte) ([]Pod, error) {
+	var list podList
+	err := json.Unmarshal(input, &list)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse list of pods: %v", err)
+	}
+
+	pods := make([]Pod, 0, len(list.Items))
+	for _, item := range list.Items {
+		pod := Pod{
+			Name:    item.Metadata.Name,
+			Phase:   item.Status.Phase,
+			Created: item.Metadata.CreationTimestamp,
+		}
+		for _, container := range item.Spec.Containers {
+			pod.Containers = append(pod.Containers, container.Name)
+		}
+		for _, status := range item.Status.ContainerStatuses {
+			pod.Restarts += status.RestartCount
+		}
+		pods = append(pods, pod)
+	}
+	return pods, nil
+}
+
+// NewClusterClient function constructs cluster client of given kind. The
+// project is used by clients that need namespace for all API calls. TLS
+// options are used to verify certificate of API server.
+func NewClusterClient(kind, project string, options TLSOptions) (ClusterClient, error) {
+	switch kind {
+	case "", ClientOc:
+		return NewOcClient(project, options), nil
+	case ClientNative:
+		// REST API paths always contain namespace
+		if project == "" {
+			return nil, fmt.Errorf("project needs to be configured for '%s' cluster client", kind)
+		}
+		return NewNativeClient(project, options)
+	}
+	return nil, fmt.Errorf("unknown cluster client '%s'", kind)
+}
+
+// ParseToken function returns bearer token from provided login string. The
+// string can contain just the token or the whole 'oc login' command with
+// --token option.
+func ParseToken(arg string) string {
+	const tokenPart = "--token="
+
+	token := arg
+
+	// check whether just token is provided or the whole oc login command
+	i := strings.LastIndex(arg, tokenPart)
+	if i >= 0 && len(arg) >= i+len(tokenPart) {
+		// get just the token part
+		token = arg[i+len(tokenPart):]
+	}
+
+	// the token might be followed by other options
+	fields := strings.Fields(token)
+	if len(fields) > 0 {
+		token = fields[0]
+	}
+
+	return token
+}
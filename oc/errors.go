@@ -0,0 +1,107 @@
+/*
+Copyright © 2020, 2021, 2022 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oc
+
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/ccx-data-pipeline-monitor/packages/oc/errors.html
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// Kinds of errors returned by cluster clients. Use errors.Is to check the
+// kind of returned error.
+var (
+	ErrUnauthorized = errors.New("not logged in or token expired")
+	ErrForbidden    = errors.New("access denied")
+	ErrNotFound     = errors.New("not found")
+	ErrTimeout      = errors.New("operation timed out")
+	ErrCancelled    = errors.New("operation cancelled")
+)
+
+// ClusterError represents error returned by cluster client together with
+// details provided by oc command or REST API
+type ClusterError struct {
+	Kind    error
+	Details string
+}
+
+// Error method returns error message including details
+func (e *ClusterError) Error() string {
+	if e.Details == "" {
+		return e.Kind.Error()
+	}
+	return e.Kind.Error() + ": " + e.Details
+}
+
+// Unwrap method returns kind of error, so errors.Is can be used
+func (e *ClusterError) Unwrap() error {
+	return e.Kind
+}
+
+// contextError function returns typed error when the operation has been
+// stopped because of its context. Nil is returned otherwise.
+func contextError(ctx context.Context) error {
+	switch ctx.Err() {
+	case context.DeadlineExceeded:
+		return &ClusterError{Kind: ErrTimeout}
+	case context.Canceled:
+		return &ClusterError{Kind: ErrCancelled}
+	}
+	return nil
+}
+
+// Messages printed by oc for known kinds of errors
+var ocErrorMessages = []struct {
+	message string
+	kind    error
+}{
+	{"Unauthorized", ErrUnauthorized},
+	{"You must be logged in", ErrUnauthorized},
+	{"token has expired", ErrUnauthorized},
+	{"Forbidden", ErrForbidden},
+	{"forbidden", ErrForbidden},
+	{"NotFound", ErrNotFound},
+	{"not found", ErrNotFound},
+}
+
+// ocError function converts error returned by oc command into typed error.
+// Error output of the command is used as error details.
+func ocError(ctx context.Context, err error, errString string) error {
+	if typed := contextError(ctx); typed != nil {
+		return typed
+	}
+
+	details := strings.TrimSpace(errString)
+	if details == "" {
+		details = err.Error()
+	}
+
+	// oc is killed by Ctrl+C pressed in terminal
+	if err.Error() == "signal: interrupt" {
+		return &ClusterError{Kind: ErrCancelled, Details: details}
+	}
+
+	for _, known := range ocErrorMessages {
+		if strings.Contains(details, known.message) {
+			return &ClusterError{Kind: known.kind, Details: details}
+		}
+	}
+	return errors.New(details)
+}
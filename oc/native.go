@@ -0,0 +1,290 @@
+/*
+Copyright © 2020, 2021, 2022 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oc
+
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/ccx-data-pipeline-monitor/packages/oc/native.html
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxErrorBodyLength is the maximum number of bytes read from body of
+// response with error status
+const maxErrorBodyLength = 1024
+
+// NativeClient performs all cluster operations directly via Kubernetes REST
+// API. Bearer token is used for authentication.
+type NativeClient struct {
+	// HTTPClient is used for all requests; it can be replaced to configure
+	// TLS or timeouts
+	HTTPClient *http.Client
+	project    string
+	url        string
+	token      string
+}
+
+// NewNativeClient function constructs client for REST API that works with
+// pods in given project (namespace). Certificate of API server is verified
+// according to TLS options.
+func NewNativeClient(project string, options TLSOptions) (*NativeClient, error) {
+	httpClient, err := newHTTPClient(options)
+	if err != nil {
+		return nil, err
+	}
+	return &NativeClient{
+		HTTPClient: httpClient,
+		project:    project,
+	}, nil
+}
+
+// statusErrors maps HTTP status codes to kinds of errors
+var statusErrors = map[int]error{
+	http.StatusUnauthorized: ErrUnauthorized,
+	http.StatusForbidden:    ErrForbidden,
+	http.StatusNotFound:     ErrNotFound,
+}
+
+// statusError function converts response with error status into error.
+// Known status codes are converted into typed errors.
+func statusError(response *http.Response) error {
+	// response body usually contains Status object with details
+	body, _ := io.ReadAll(io.LimitReader(response.Body, maxErrorBodyLength))
+	_ = response.Body.Close()
+
+	details := response.Status + ": " + strings.TrimSpace(string(body))
+	kind, found := statusErrors[response.StatusCode]
+	if !found {
+		kind = errors.New("unexpected response")
+	}
+	return &ClusterError{Kind: kind, Details: details}
+}
+
+// requestError function returns typed error when the request has been
+// stopped because of its context, the original error is returned otherwise
+func requestError(ctx context.Context, err error) error {
+	if typed := contextError(ctx); typed != nil {
+		return typed
+	}
+	return err
+}
+
+// request method performs GET request to REST API and returns response for
+// successful requests only. The request is aborted when the context is
+// cancelled or its deadline expires.
+func (client *NativeClient) request(ctx context.Context, path string, query url.Values) (*http.Response, error) {
+	if client.url == "" {
+		return nil, &ClusterError{Kind: ErrUnauthorized}
+	}
+
+	address := strings.TrimSuffix(client.url, "/") + path
+	if len(query) > 0 {
+		address += "?" + query.Encode()
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, address, http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Authorization", "Bearer "+client.token)
+
+	response, err := client.HTTPClient.Do(request)
+	if err != nil {
+		return nil, requestError(ctx, err)
+	}
+
+	if response.StatusCode != http.StatusOK {
+		return nil, statusError(response)
+	}
+	return response, nil
+}
+
+// requestBody method performs GET request to REST API and returns body of
+// successful response
+func (client *NativeClient) requestBody(ctx context.Context, path string, query url.Values) ([]byte, error) {
+	response, err := client.request(ctx, path, query)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, requestError(ctx, err)
+	}
+	return body, nil
+}
+
+// Project method returns project used for all operations
+func (client *NativeClient) Project() string {
+	return client.project
+}
+
+// SetProject method selects project used for all operations
+func (client *NativeClient) SetProject(project string) {
+	client.project = project
+}
+
+// podsPath method returns path to pods resource in selected project
+func (client *NativeClient) podsPath() string {
+	return "/api/v1/namespaces/" + url.PathEscape(client.project) + "/pods"
+}
+
+// logPath method returns path to logs of selected pod
+func (client *NativeClient) logPath(pod string) string {
+	return client.podsPath() + "/" + url.PathEscape(pod) + "/log"
+}
+
+// logQuery function converts log options into query parameters
+func logQuery(options LogOptions) url.Values {
+	query := url.Values{}
+	if options.Previous {
+		query.Set("previous", "true")
+	}
+	if options.Since != 0 {
+		// API accepts whole seconds only
+		seconds := int64(options.Since / time.Second)
+		if seconds < 1 {
+			seconds = 1
+		}
+		query.Set("sinceSeconds", strconv.FormatInt(seconds, 10))
+	}
+	if !options.SinceTime.IsZero() {
+		query.Set("sinceTime", options.SinceTime.UTC().Format(time.RFC3339))
+	}
+	if options.TailLines != 0 {
+		query.Set("tailLines", strconv.Itoa(options.TailLines))
+	}
+	if options.LimitBytes != 0 {
+		query.Set("limitBytes", strconv.FormatInt(options.LimitBytes, 10))
+	}
+	return query
+}
+
+// Login method remembers API URL and token and checks the token by WhoAmI
+// call. The previous token is kept when the new one is not valid.
+func (client *NativeClient) Login(ctx context.Context, address, login string) error {
+	previousURL, previousToken := client.url, client.token
+	client.url = address
+	client.token = ParseToken(login)
+
+	_, err := client.WhoAmI(ctx)
+	if err != nil {
+		client.url, client.token = previousURL, previousToken
+		return err
+	}
+	return nil
+}
+
+// Logout method forgets API URL and token
+func (client *NativeClient) Logout() error {
+	client.url = ""
+	client.token = ""
+	return nil
+}
+
+// user is the subset of OpenShift User object that is needed by WhoAmI
+type user struct {
+	Metadata struct {
+		Name string `json:"name"`
+	} `json:"metadata"`
+}
+
+// WhoAmI method returns identity of user the token belongs to. Expiration
+// of the token is read from UserOAuthAccessToken object when possible, zero
+// expiration time is returned otherwise.
+func (client *NativeClient) WhoAmI(ctx context.Context) (Identity, error) {
+	body, err := client.requestBody(ctx, "/apis/user.openshift.io/v1/users/~", nil)
+	if err != nil {
+		return Identity{}, err
+	}
+	var current user
+	err = json.Unmarshal(body, &current)
+	if err != nil {
+		return Identity{}, fmt.Errorf("unable to parse user: %v", err)
+	}
+	identity := Identity{User: current.Metadata.Name}
+
+	name := tokenObjectName(client.token)
+	if name == "" {
+		return identity, nil
+	}
+	body, err = client.requestBody(ctx, "/apis/oauth.openshift.io/v1/useroauthaccesstokens/"+url.PathEscape(name), nil)
+	if err != nil {
+		// the token can be used, just its expiration is not known
+		return identity, nil
+	}
+	// unknown format of the object means unknown expiration
+	identity.Expires, _ = parseTokenExpiration(body)
+	return identity, nil
+}
+
+// GetPods method reads list of pods in selected project that match label
+// selector
+func (client *NativeClient) GetPods(ctx context.Context, selector string) ([]Pod, error) {
+	query := url.Values{}
+	if selector != "" {
+		query.Set("labelSelector", selector)
+	}
+	body, err := client.requestBody(ctx, client.podsPath(), query)
+	if err != nil {
+		return nil, err
+	}
+	return parsePodList(body)
+}
+
+// GetLogs method reads logs for selected pod and writes them into provided
+// writer
+func (client *NativeClient) GetLogs(ctx context.Context, pod string, options LogOptions, w io.Writer) error {
+	err := options.Validate()
+	if err != nil {
+		return err
+	}
+	response, err := client.request(ctx, client.logPath(pod), logQuery(options))
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(w, response.Body)
+	closeErr := response.Body.Close()
+	if err != nil {
+		return requestError(ctx, err)
+	}
+	return closeErr
+}
+
+// FollowLogs method starts reading logs for selected pod including all new
+// log entries. Closing the returned reader or cancelling the context closes
+// the connection.
+func (client *NativeClient) FollowLogs(ctx context.Context, pod string) (io.ReadCloser, error) {
+	response, err := client.request(ctx, client.logPath(pod), url.Values{"follow": {"true"}})
+	if err != nil {
+		return nil, err
+	}
+	return response.Body, nil
+}
@@ -0,0 +1,253 @@
+/*
+Copyright © 2020, 2021, 2022 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const (
+	testToken   = "test-token"
+	testProject = "ccx-data-pipeline"
+	testPod     = "aggregator-1"
+)
+
+// podListJSON contains list with one pod as returned by REST API
+const podListJSON = `{"items":[{"metadata":{"name":"aggregator-1","creationTimestamp":"2022-03-01T10:00:00Z"},
+"spec":{"containers":[{"name":"aggregator"}]},
+"status":{"phase":"Running","containerStatuses":[{"name":"aggregator","restartCount":2}]}}]}`
+
+// testAPI function returns handler that simulates parts of OpenShift REST
+// API used by native client. Requests without the test token are rejected.
+func testAPI(t *testing.T, logs http.HandlerFunc) http.Handler {
+	mux := http.NewServeMux()
+	authorized := func(handler http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer "+testToken {
+				http.Error(w, `{"kind":"Status","reason":"Unauthorized"}`, http.StatusUnauthorized)
+				return
+			}
+			handler(w, r)
+		}
+	}
+	mux.HandleFunc("/apis/user.openshift.io/v1/users/~", authorized(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"metadata":{"name":"tester"}}`)
+	}))
+	mux.HandleFunc("/api/v1/namespaces/"+testProject+"/pods", authorized(func(w http.ResponseWriter, r *http.Request) {
+		if selector := r.URL.Query().Get("labelSelector"); selector != "app=aggregator" {
+			t.Errorf("unexpected label selector %q", selector)
+		}
+		fmt.Fprint(w, podListJSON)
+	}))
+	mux.HandleFunc("/api/v1/namespaces/"+testProject+"/pods/"+testPod+"/log", authorized(logs))
+	return mux
+}
+
+// loggedInClient function constructs native client logged into test server
+func loggedInClient(t *testing.T, server *httptest.Server, options TLSOptions) *NativeClient {
+	client, err := NewNativeClient(testProject, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.Login(context.Background(), server.URL, testToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestNativeClientGetPods(t *testing.T) {
+	server := httptest.NewServer(testAPI(t, nil))
+	defer server.Close()
+	client := loggedInClient(t, server, TLSOptions{})
+
+	pods, err := client.GetPods(context.Background(), "app=aggregator")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pods) != 1 {
+		t.Fatalf("expected one pod, got %d", len(pods))
+	}
+	pod := pods[0]
+	if pod.Name != testPod || pod.Phase != "Running" || pod.Restarts != 2 || len(pod.Containers) != 1 {
+		t.Errorf("unexpected pod %+v", pod)
+	}
+}
+
+func TestNativeClientGetLogs(t *testing.T) {
+	server := httptest.NewServer(testAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("previous") != "true" || query.Get("tailLines") != "10" || query.Get("sinceSeconds") != "60" {
+			t.Errorf("unexpected query %s", r.URL.RawQuery)
+		}
+		fmt.Fprintln(w, `{"level":"info","message":"Consumed"}`)
+		fmt.Fprintln(w, `{"level":"info","message":"Read"}`)
+	}))
+	defer server.Close()
+	client := loggedInClient(t, server, TLSOptions{})
+
+	var logs bytes.Buffer
+	options := LogOptions{Previous: true, TailLines: 10, Since: time.Minute}
+	err := client.GetLogs(context.Background(), testPod, options, &logs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "{\"level\":\"info\",\"message\":\"Consumed\"}\n{\"level\":\"info\",\"message\":\"Read\"}\n"
+	if logs.String() != expected {
+		t.Errorf("unexpected logs %q", logs.String())
+	}
+}
+
+func TestNativeClientFollowLogs(t *testing.T) {
+	next := make(chan string)
+	server := httptest.NewServer(testAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("follow") != "true" {
+			t.Errorf("logs are not followed: %s", r.URL.RawQuery)
+		}
+		// headers are sent first, so the client does not wait for logs
+		flusher := w.(http.Flusher)
+		flusher.Flush()
+		for {
+			select {
+			case line := <-next:
+				fmt.Fprintln(w, line)
+				flusher.Flush()
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}))
+	defer server.Close()
+	client := loggedInClient(t, server, TLSOptions{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream, err := client.FollowLogs(ctx, testPod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+
+	// lines are streamed one by one as they are written
+	reader := bufio.NewReader(stream)
+	for _, expected := range []string{"first", "second"} {
+		next <- expected
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if line != expected+"\n" {
+			t.Errorf("expected line %q, got %q", expected, line)
+		}
+	}
+
+	cancel()
+	_, err = reader.ReadString('\n')
+	if err == nil {
+		t.Error("stream is not closed by cancelled context")
+	}
+}
+
+func TestNativeClientUnauthorized(t *testing.T) {
+	server := httptest.NewServer(testAPI(t, nil))
+	defer server.Close()
+
+	client, err := NewNativeClient(testProject, TLSOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.Login(context.Background(), server.URL, "wrong-token")
+	if !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("expected ErrUnauthorized, got %v", err)
+	}
+
+	// operations without login are rejected without any request
+	_, err = client.GetPods(context.Background(), "")
+	if !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("expected ErrUnauthorized, got %v", err)
+	}
+}
+
+func TestNativeClientTimeout(t *testing.T) {
+	server := httptest.NewServer(testAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+	client := loggedInClient(t, server, TLSOptions{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	var logs bytes.Buffer
+	err := client.GetLogs(ctx, testPod, LogOptions{}, &logs)
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expected ErrTimeout, got %v", err)
+	}
+}
+
+func TestNativeClientTLS(t *testing.T) {
+	server := httptest.NewTLSServer(testAPI(t, nil))
+	defer server.Close()
+
+	// certificate of test server is signed by itself
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	certificate := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	err := os.WriteFile(caFile, certificate, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		options TLSOptions
+		valid   bool
+	}{
+		{"unknown CA", TLSOptions{}, false},
+		{"configured CA", TLSOptions{CAFile: caFile}, true},
+		{"insecure", TLSOptions{Insecure: true}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client, err := NewNativeClient(testProject, test.options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = client.Login(context.Background(), server.URL, testToken)
+			if test.valid && err != nil {
+				t.Errorf("login failed: %v", err)
+			}
+			if !test.valid && err == nil {
+				t.Error("certificate signed by unknown CA is accepted")
+			}
+		})
+	}
+
+	_, err = NewNativeClient(testProject, TLSOptions{CAFile: filepath.Join(t.TempDir(), "missing.crt")})
+	if err == nil {
+		t.Error("missing CA bundle is accepted")
+	}
+}
@@ -21,15 +21,43 @@ package oc
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
 	"os/exec"
+	"strconv"
 	"strings"
+	"time"
 )
 
-// Command run any oc command and return its standard and error outputs
-func Command(args ...string) (outString, errString string, err error) {
+// OcClient performs all cluster operations by running oc binary. Project
+// is passed to each command explicitly, so the current project of oc
+// context is never used. After login, the token is stored in private
+// kubeconfig file that is passed to each command, so the token never
+// appears in command line arguments and user's oc context is not changed.
+type OcClient struct {
+	project    string
+	kubeconfig string
+	tls        TLSOptions
+}
+
+// NewOcClient function constructs client that works with pods in given
+// project (namespace). TLS options are stored into kubeconfig written by
+// login.
+func NewOcClient(project string, options TLSOptions) *OcClient {
+	return &OcClient{
+		project: project,
+		tls:     options,
+	}
+}
+
+// Command run any oc command and return its standard and error outputs. The
+// command is killed when the context is cancelled or its deadline expires.
+func Command(ctx context.Context, args ...string) (outString, errString string, err error) {
 	// disable "G204 (CWE-78): Subprocess launched with variable
 	// #nosec G204
-	cmd := exec.Command("oc", args...)
+	cmd := exec.CommandContext(ctx, "oc", args...)
 
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
@@ -45,33 +73,261 @@ func Command(args ...string) (outString, errString string, err error) {
 	return outString, errString, nil
 }
 
-// Login perform login into oc
-func Login(url, arg string) (outString, errString string, err error) {
-	token := getToken(arg)
-	return Command("login", url, "--token="+token)
+// StreamCommand run any oc command and writes its standard output directly
+// into provided writer, so the output is not kept in memory. The command is
+// killed when the context is cancelled or its deadline expires.
+func StreamCommand(ctx context.Context, stdout io.Writer, args ...string) (errString string, err error) {
+	// disable "G204 (CWE-78): Subprocess launched with variable
+	// #nosec G204
+	cmd := exec.CommandContext(ctx, "oc", args...)
+
+	var stderr bytes.Buffer
+	cmd.Stdout = stdout
+	cmd.Stderr = &stderr
+
+	err = cmd.Run()
+	return stderr.String(), err
+}
+
+// namespaced method adds kubeconfig and project selection to oc command
+// arguments
+func (client *OcClient) namespaced(args ...string) []string {
+	options := []string{}
+	if client.kubeconfig != "" {
+		options = append(options, "--kubeconfig="+client.kubeconfig)
+	}
+	if client.project != "" {
+		options = append(options, "--namespace="+client.project)
+	}
+	return append(options, args...)
+}
+
+// Project method returns project used for all operations
+func (client *OcClient) Project() string {
+	return client.project
+}
+
+// SetProject method selects project used for all operations
+func (client *OcClient) SetProject(project string) {
+	client.project = project
+}
+
+// logArgs function converts log options into oc command arguments
+func logArgs(options LogOptions) []string {
+	args := []string{}
+	if options.Previous {
+		args = append(args, "--previous")
+	}
+	if options.Since != 0 {
+		args = append(args, "--since="+options.Since.String())
+	}
+	if !options.SinceTime.IsZero() {
+		args = append(args, "--since-time="+options.SinceTime.UTC().Format(time.RFC3339))
+	}
+	if options.TailLines != 0 {
+		args = append(args, "--tail="+strconv.Itoa(options.TailLines))
+	}
+	if options.LimitBytes != 0 {
+		args = append(args, "--limit-bytes="+strconv.FormatInt(options.LimitBytes, 10))
+	}
+	return args
 }
 
-// GetPods function reads list of all pods via oc command
-func GetPods() (outString, errString string, err error) {
-	return Command("get", "pods")
+// kubeconfigEntry represents named cluster, user or context in kubeconfig
+type kubeconfigEntry struct {
+	Name    string                 `json:"name"`
+	Cluster map[string]interface{} `json:"cluster,omitempty"`
+	User    map[string]string      `json:"user,omitempty"`
+	Context map[string]string      `json:"context,omitempty"`
 }
 
-// GetLogs functions reads logs for selected pod
-func GetLogs(pod string) (outString, errString string, err error) {
-	return Command("logs", pod)
+// kubeconfig represents minimal kubeconfig file with one cluster, user and
+// context. JSON format is accepted by oc as well as YAML.
+type kubeconfig struct {
+	APIVersion     string            `json:"apiVersion"`
+	Kind           string            `json:"kind"`
+	Clusters       []kubeconfigEntry `json:"clusters"`
+	Users          []kubeconfigEntry `json:"users"`
+	Contexts       []kubeconfigEntry `json:"contexts"`
+	CurrentContext string            `json:"current-context"`
 }
 
-func getToken(arg string) string {
-	const tokenPart = "--token="
+// kubeconfigName is the name of cluster, user and context in kubeconfig
+const kubeconfigName = "ccx-data-pipeline-monitor"
 
-	token := arg
+// writeKubeconfig function stores server URL, TLS options, and token into
+// new temporary kubeconfig file readable by the current user only. Name of
+// the file is returned.
+func writeKubeconfig(url, token string, options TLSOptions) (string, error) {
+	cluster := map[string]interface{}{"server": url}
+	if options.CAFile != "" {
+		cluster["certificate-authority"] = options.CAFile
+	}
+	if options.Insecure {
+		cluster["insecure-skip-tls-verify"] = true
+	}
+	config := kubeconfig{
+		APIVersion: "v1",
+		Kind:       "Config",
+		Clusters: []kubeconfigEntry{
+			{Name: kubeconfigName, Cluster: cluster},
+		},
+		Users: []kubeconfigEntry{
+			{Name: kubeconfigName, User: map[string]string{"token": token}},
+		},
+		Contexts: []kubeconfigEntry{
+			{Name: kubeconfigName, Context: map[string]string{"cluster": kubeconfigName, "user": kubeconfigName}},
+		},
+		CurrentContext: kubeconfigName,
+	}
 
-	// check whether just token is provided or the whole oc login command
-	i := strings.LastIndex(arg, tokenPart)
-	if i >= 0 && len(arg) >= i+len(tokenPart) {
-		// get just the token part
-		token = arg[i+len(tokenPart):]
+	content, err := json.Marshal(config)
+	if err != nil {
+		return "", err
 	}
 
-	return token
+	// temporary files are created with 0600 permissions
+	file, err := os.CreateTemp("", "ccx-monitor-kubeconfig-*")
+	if err != nil {
+		return "", err
+	}
+	_, err = file.Write(content)
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
+
+// Login method stores the token into private kubeconfig file and checks it
+// by 'oc whoami' command. The previous kubeconfig is kept when the token is
+// not valid.
+func (client *OcClient) Login(ctx context.Context, url, login string) error {
+	filename, err := writeKubeconfig(url, ParseToken(login), client.tls)
+	if err != nil {
+		return err
+	}
+
+	_, stderr, err := Command(ctx, "--kubeconfig="+filename, "whoami")
+	if err != nil {
+		_ = os.Remove(filename)
+		return ocError(ctx, err, stderr)
+	}
+
+	err = client.Logout()
+	client.kubeconfig = filename
+	return err
+}
+
+// Logout method removes private kubeconfig file, so oc context of the user
+// is used again
+func (client *OcClient) Logout() error {
+	if client.kubeconfig == "" {
+		return nil
+	}
+	err := os.Remove(client.kubeconfig)
+	client.kubeconfig = ""
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// WhoAmI method returns identity of logged in user via 'oc whoami' command.
+// Expiration of the token is read from UserOAuthAccessToken object when
+// possible, zero expiration time is returned otherwise.
+func (client *OcClient) WhoAmI(ctx context.Context) (Identity, error) {
+	stdout, stderr, err := Command(ctx, client.namespaced("whoami")...)
+	if err != nil {
+		return Identity{}, ocError(ctx, err, stderr)
+	}
+	identity := Identity{User: strings.TrimSpace(stdout)}
+
+	// 'oc whoami -t' prints token from kubeconfig; the token is read
+	// via pipe, so it does not appear in command line arguments
+	token, _, err := Command(ctx, client.namespaced("whoami", "-t")...)
+	if err != nil {
+		return identity, nil
+	}
+	name := tokenObjectName(strings.TrimSpace(token))
+	if name == "" {
+		return identity, nil
+	}
+	stdout, _, err = Command(ctx, client.namespaced("get", "useroauthaccesstokens", name, "-o", "json")...)
+	if err != nil {
+		// the token can be used, just its expiration is not known
+		return identity, nil
+	}
+	// unknown format of the object means unknown expiration
+	identity.Expires, _ = parseTokenExpiration([]byte(stdout))
+	return identity, nil
+}
+
+// GetPods method reads list of pods matching label selector via oc command
+func (client *OcClient) GetPods(ctx context.Context, selector string) ([]Pod, error) {
+	args := []string{"get", "pods", "-o", "json"}
+	if selector != "" {
+		args = append(args, "--selector="+selector)
+	}
+	stdout, stderr, err := Command(ctx, client.namespaced(args...)...)
+	if err != nil {
+		return nil, ocError(ctx, err, stderr)
+	}
+	return parsePodList([]byte(stdout))
+}
+
+// GetLogs method reads logs for selected pod and writes them into provided
+// writer
+func (client *OcClient) GetLogs(ctx context.Context, pod string, options LogOptions, w io.Writer) error {
+	err := options.Validate()
+	if err != nil {
+		return err
+	}
+	args := append([]string{"logs", pod}, logArgs(options)...)
+	stderr, err := StreamCommand(ctx, w, client.namespaced(args...)...)
+	if err != nil {
+		return ocError(ctx, err, stderr)
+	}
+	return nil
+}
+
+// followedLogs represents standard output of running 'oc logs -f' command.
+// Closing it stops the command.
+type followedLogs struct {
+	io.ReadCloser
+	cmd *exec.Cmd
+}
+
+// Close method kills oc process and waits for it
+func (logs *followedLogs) Close() error {
+	err := logs.cmd.Process.Kill()
+	if err != nil && err != os.ErrProcessDone {
+		return err
+	}
+	// the process has been killed, so exit status is not interesting
+	_ = logs.cmd.Wait()
+	return nil
+}
+
+// FollowLogs method starts reading logs for selected pod including all new
+// log entries. The command is stopped when the context is cancelled.
+func (client *OcClient) FollowLogs(ctx context.Context, pod string) (io.ReadCloser, error) {
+	// disable "G204 (CWE-78): Subprocess launched with variable
+	// #nosec G204
+	cmd := exec.CommandContext(ctx, "oc", client.namespaced("logs", "-f", pod)...)
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		return nil, err
+	}
+	return &followedLogs{stdout, cmd}, nil
 }
@@ -0,0 +1,162 @@
+/*
+Copyright © 2020, 2021, 2022 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oc
+
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/ccx-data-pipeline-monitor/packages/oc/session.html
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// Parameters of session file encryption. The key is derived from
+// passphrase by PBKDF2 with HMAC-SHA256 and the session is encrypted by
+// AES-256 in GCM mode.
+const (
+	sessionVersion    = 1
+	sessionSaltLength = 16
+	sessionKeyLength  = 32
+	sessionIterations = 600000
+)
+
+// Session contains everything needed to log into the cluster again after
+// the monitor is restarted
+type Session struct {
+	URL   string    `json:"url"`
+	Token string    `json:"token"`
+	Saved time.Time `json:"saved"`
+}
+
+// sessionCipher function constructs AEAD cipher for given passphrase and
+// salt
+func sessionCipher(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key := pbkdf2.Key([]byte(passphrase), salt, sessionIterations, sessionKeyLength, sha256.New)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// SaveSession function encrypts session by passphrase and stores it into
+// file readable by the current user only. The file contains version, salt,
+// nonce and encrypted session.
+func SaveSession(filename, passphrase string, session Session) error {
+	if passphrase == "" {
+		return errors.New("passphrase for session file is not set")
+	}
+	plaintext, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+
+	salt := make([]byte, sessionSaltLength)
+	_, err = rand.Read(salt)
+	if err != nil {
+		return err
+	}
+	aead, err := sessionCipher(passphrase, salt)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return err
+	}
+
+	content := append([]byte{sessionVersion}, salt...)
+	content = append(content, nonce...)
+	// version and salt are authenticated too
+	content = aead.Seal(content, nonce, plaintext, content[:1+sessionSaltLength])
+
+	return writePrivateFile(filename, content)
+}
+
+// writePrivateFile function writes content into file readable by the
+// current user only. The file might exist with wider permissions, so the
+// content is written into new file in the same directory that replaces the
+// original one.
+func writePrivateFile(filename string, content []byte) error {
+	file, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".*")
+	if err != nil {
+		return err
+	}
+	temporary := file.Name()
+
+	err = file.Chmod(0o600)
+	if err == nil {
+		_, err = file.Write(content)
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(temporary, filename)
+	}
+	if err != nil {
+		_ = os.Remove(temporary)
+	}
+	return err
+}
+
+// LoadSession function reads session from file and decrypts it by
+// passphrase
+func LoadSession(filename, passphrase string) (Session, error) {
+	var session Session
+
+	// disable "G304 (CWE-22): Potential file inclusion via variable"
+	content, err := os.ReadFile(filename) // #nosec G304
+	if err != nil {
+		return session, err
+	}
+	if len(content) < 1+sessionSaltLength || content[0] != sessionVersion {
+		return session, fmt.Errorf("unknown format of session file %s", filename)
+	}
+
+	header := content[:1+sessionSaltLength]
+	aead, err := sessionCipher(passphrase, header[1:])
+	if err != nil {
+		return session, err
+	}
+	rest := content[len(header):]
+	if len(rest) < aead.NonceSize() {
+		return session, fmt.Errorf("session file %s is truncated", filename)
+	}
+
+	plaintext, err := aead.Open(nil, rest[:aead.NonceSize()], rest[aead.NonceSize():], header)
+	if err != nil {
+		return session, errors.New("unable to decrypt session file, wrong passphrase?")
+	}
+	err = json.Unmarshal(plaintext, &session)
+	return session, err
+}
@@ -0,0 +1,186 @@
+/*
+Copyright © 2020, 2021, 2022 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package oc
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+func TestPBKDF2KeyVectors(t *testing.T) {
+	// published PBKDF2-HMAC-SHA256 test vectors, the last two are from
+	// RFC 7914, section 11
+	tests := []struct {
+		password   string
+		salt       string
+		iterations int
+		key        string
+	}{
+		{"password", "salt", 1, "120fb6cffcf8b32c43e7225256c4f837a86548c92ccc35480805987cb70be17b"},
+		{"password", "salt", 2, "ae4d0c95af6b46d32d0adff928f06dd02a303f8ef3c251dfd6e2d85a95474c43"},
+		{"password", "salt", 4096, "c5e478d59288c841aa530db6845c4c8d962893a001ce4e11a4963873aa98134a"},
+		{"passwordPASSWORDpassword", "saltSALTsaltSALTsaltSALTsaltSALTsalt", 4096, "348c89dbcbd32b2f32d814b8116e84cf2b17347ebc1800181c4e2a1fb8dd53e1c635518c7dac47e9"},
+		{"pass\x00word", "sa\x00lt", 4096, "89b69d0516f829893c696226650a8687"},
+		{"passwd", "salt", 1, "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783"},
+		{"Password", "NaCl", 80000, "4ddcd8f60b98be21830cee5ef22701f9641a4418d04c0414aeff08876b34ab56a1d425a1225833549adb841b51c9b3176a272bdebba1d078478f62b397f33c8d"},
+	}
+
+	for _, test := range tests {
+		expected, err := hex.DecodeString(test.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key := pbkdf2.Key([]byte(test.password), []byte(test.salt), test.iterations, len(expected), sha256.New)
+		if hex.EncodeToString(key) != test.key {
+			t.Errorf("PBKDF2(%q, %q, %d): expected %s, got %x", test.password, test.salt, test.iterations, test.key, key)
+		}
+	}
+}
+
+// testSession contains session stored by tests
+var testSession = Session{
+	URL:   "https://api.example.com:6443",
+	Token: "sha256~secret",
+	Saved: time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC),
+}
+
+func TestSessionRoundTrip(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "session")
+	err := SaveSession(filename, "correct horse", testSession)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("session file is readable by others: %v", info.Mode().Perm())
+	}
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(content), testSession.Token) {
+		t.Error("token is stored in plain text")
+	}
+
+	session, err := LoadSession(filename, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.URL != testSession.URL || session.Token != testSession.Token || !session.Saved.Equal(testSession.Saved) {
+		t.Errorf("expected session %+v, got %+v", testSession, session)
+	}
+
+	_, err = LoadSession(filename, "wrong horse")
+	if err == nil || !strings.Contains(err.Error(), "wrong passphrase") {
+		t.Errorf("expected wrong passphrase error, got %v", err)
+	}
+}
+
+func TestSaveSessionOverReadableFile(t *testing.T) {
+	directory := t.TempDir()
+	filename := filepath.Join(directory, "session")
+	err := os.WriteFile(filename, []byte("old session"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = SaveSession(filename, "correct horse", testSession)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("session file is readable by others: %v", info.Mode().Perm())
+	}
+	files, err := os.ReadDir(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Errorf("expected just the session file, got %d files", len(files))
+	}
+	_, err = LoadSession(filename, "correct horse")
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSaveSessionWithoutPassphrase(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "session")
+	err := SaveSession(filename, "", testSession)
+	if err == nil {
+		t.Error("session saved without passphrase")
+	}
+	if _, err := os.Stat(filename); !os.IsNotExist(err) {
+		t.Errorf("session file has been created: %v", err)
+	}
+}
+
+func TestLoadDamagedSession(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "session")
+	err := SaveSession(filename, "correct horse", testSession)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unknownVersion := append([]byte{}, content...)
+	unknownVersion[0] = sessionVersion + 1
+	// salt is authenticated, so the session can't be decrypted
+	modifiedSalt := append([]byte{}, content...)
+	modifiedSalt[1] ^= 1
+
+	tests := []struct {
+		name     string
+		content  []byte
+		expected string
+	}{
+		{"unknown version", unknownVersion, "unknown format"},
+		{"truncated", content[:1+sessionSaltLength+4], "truncated"},
+		{"modified salt", modifiedSalt, "unable to decrypt"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			damaged := filepath.Join(t.TempDir(), "session")
+			err := os.WriteFile(damaged, test.content, 0o600)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = LoadSession(damaged, "correct horse")
+			if err == nil || !strings.Contains(err.Error(), test.expected) {
+				t.Errorf("expected error '%s', got %v", test.expected, err)
+			}
+		})
+	}
+}
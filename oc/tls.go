@@ -0,0 +1,93 @@
+/*
+Copyright © 2020, 2021, 2022 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oc
+
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/ccx-data-pipeline-monitor/packages/oc/tls.html
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// serviceAccountCAFile is CA bundle mounted into pods, it is used to verify
+// API server when the monitor runs inside the cluster
+const serviceAccountCAFile = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+
+// TLSOptions represents options used to verify certificate of API server.
+// Certificates signed by CA from CAFile are trusted in addition to system
+// certificates. Insecure disables verification completely.
+type TLSOptions struct {
+	CAFile   string
+	Insecure bool
+}
+
+// caFile method returns CA bundle used to verify API server. Service account
+// CA bundle is used when no file is configured and the bundle exists.
+func (options TLSOptions) caFile() string {
+	if options.CAFile != "" {
+		return options.CAFile
+	}
+	if _, err := os.Stat(serviceAccountCAFile); err == nil {
+		return serviceAccountCAFile
+	}
+	return ""
+}
+
+// newTLSConfig function constructs TLS configuration according to options
+func newTLSConfig(options TLSOptions) (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		// disable "G402 (CWE-295): TLS InsecureSkipVerify may be true"
+		InsecureSkipVerify: options.Insecure, // #nosec G402
+	}
+
+	filename := options.caFile()
+	if filename == "" {
+		return config, nil
+	}
+	// disable "G304 (CWE-22): Potential file inclusion via variable"
+	pem, err := os.ReadFile(filename) // #nosec G304
+	if err != nil {
+		return nil, fmt.Errorf("unable to read CA bundle: %v", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in CA bundle %s", filename)
+	}
+	config.RootCAs = pool
+	return config, nil
+}
+
+// newHTTPClient function constructs HTTP client that verifies API server
+// according to TLS options. Proxy settings and other defaults are taken
+// from the default transport.
+func newHTTPClient(options TLSOptions) (*http.Client, error) {
+	config, err := newTLSConfig(options)
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = config
+	return &http.Client{Transport: transport}, nil
+}